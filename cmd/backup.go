@@ -0,0 +1,70 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"log"
+
+	"github.com/rormartin/amqp-go-tool/pkg/amqptool"
+	"github.com/spf13/cobra"
+)
+
+var (
+	backupOut     string
+	managementURL string
+)
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup [queues...]",
+	Short: "Snapshot queues into a backup archive",
+	Long: `Snapshot the messages of one or more queues into a tar.gz archive.
+
+The messages are not removed from the queues: they are read and
+requeued in the same order, as copy does. The archive has a
+jsonl file with the message envelopes of every queue and a manifest
+with the queue names, the message counts and the SHA-256 checksum of
+every file.
+
+AMQP doesn't expose the queue arguments: with --management-url the
+definition of every queue (durability and arguments) is read from the
+management API, with the connection credentials, and stored in the
+manifest, so restore can declare the queues. Without it, the queues
+must exist to restore the backup.  `,
+
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if backupOut == "" {
+			log.Fatal("The backup needs an --out archive")
+		}
+		filters, err := filterOption()
+		if err != nil {
+			log.Fatal(err)
+		}
+		amcmd := amqptool.NewCommandInfo(amqptool.WithConnection(connection), filters,
+			amqptool.WithManagementURL(managementURL))
+		runCommand(amcmd, func(ctx context.Context) error {
+			return amcmd.CommandBackupContext(ctx, backupOut, args...)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+
+	backupCmd.Flags().StringVar(&backupOut, "out", "", "Archive file of the backup, e.g. backup.tar.gz")
+	backupCmd.Flags().StringVar(&managementURL, "management-url", "", "Management API to read the queue definitions from, e.g. http://localhost:15672")
+	backupCmd.Flags().StringArrayVar(&where, "where", nil, whereUsage)
+}
@@ -14,42 +14,59 @@
 package cmd
 
 import (
+	"context"
 	"log"
+	"time"
 
-	"github.com/rormartin/amqp-go-tool/internal/pkg/amqpcmds"
+	"github.com/rormartin/amqp-go-tool/pkg/amqptool"
 	"github.com/spf13/cobra"
 )
 
 // moveCmd represents the move command
 var copyCmd = &cobra.Command{
-	Use:   "copy [origin_queue] [destiny_queue]",
+	Use:   "copy [origin_queue] [destiny_queue_or_exchange]",
 	Short: "Copy messages from one queue to another one",
 	Long: `Copy messages from one queue to another one.
 
 The messages processed are also written in a external file (or stdout
-if file is not specified).  `,
+if file is not specified).
+
+The copy is a snapshot of the messages in the origin queue at start
+(limited by --count): they are held without acknowledging them and
+requeued all together at the end, so the origin queue keeps the same
+messages in the same order, flagged as redelivered. Messages published
+to the origin queue while copying are not copied.
+
+With --exchange the messages are published to the exchange with the
+routing key of the --routing-key-header header, the --routing-key
+value or their original routing key, in that order.  `,
 
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		src := args[0]
 		dst := args[1]
-		amcmd := amqpcmds.NewCommandInfo(
-			username,
-			password,
-			host,
-			port,
-			false,
-			prefetch,
-			count,
-			file,
-			formatPrefix,
-			formatSeparator,
-			formatPostfix,
-		)
-		err := amcmd.CommandCopyMoveToQueue(src, dst)
+		shovel, err := shovelOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		filters, err := filterOption()
+		if err != nil {
+			log.Fatal(err)
+		}
+		rewrite, err := rewriteOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		publish, err := publishOptions()
 		if err != nil {
 			log.Fatal(err)
 		}
+		opts := append(consumeOptions(amqptool.WithSnapshot(true), filters), publish...)
+		opts = append(opts, rewrite...)
+		amcmd := amqptool.NewCommandInfo(append(opts, shovel...)...)
+		runCommand(amcmd, func(ctx context.Context) error {
+			return amcmd.CommandCopyMoveToQueueContext(ctx, src, dst)
+		})
 	},
 }
 
@@ -57,9 +74,26 @@ func init() {
 	rootCmd.AddCommand(copyCmd)
 
 	copyCmd.Flags().StringVar(&file, "file", "", "Output file for messages (no value for stdout)")
-	copyCmd.Flags().IntVar(&count, "count", 0, "Messages to export (0 for keep waiting for messages)")
+	copyCmd.Flags().StringVar(&compress, "compress", "", "Compress the output: gzip, zstd or none (default from the file extension: .gz, .zst or .zstd)")
+	copyCmd.Flags().IntVar(&count, "count", 0, "Messages to copy (0 for all the messages in the queue at start)")
+	copyCmd.Flags().BoolVar(&untilEmpty, "until-empty", false, "Stop once the messages in the queue at start are processed")
+	copyCmd.Flags().DurationVar(&idleTimeout, "idle-timeout", 0, "Stop when no message arrives for the given duration, e.g. 30s (0 for keep waiting)")
 	copyCmd.Flags().IntVar(&prefetch, "prefetch", 1, "Prefetch value to consumer messages")
+	copyCmd.Flags().MarkDeprecated("prefetch", "the copy prefetches the whole snapshot of the queue")
+	copyCmd.Flags().StringArrayVar(&where, "where", nil, whereUsage)
+	addRewriteFlags(copyCmd)
+	copyCmd.Flags().StringVar(&format, "format", amqptool.FormatRaw, "Output format: raw (message bodies with prefix, separator and post-fix), jsonl (one JSON message envelope per line) or csv (a row with the --columns per message)")
+	copyCmd.Flags().StringSliceVar(&columns, "columns", amqptool.DefaultColumns, "Columns of the csv format: message properties (message_id, timestamp, routing_key, ...), headers.NAME, body or body.PATH for JSON body fields, as in --where")
 	copyCmd.Flags().StringVar(&formatPrefix, "formatPrefix", "", "Prefix value for the message list")
 	copyCmd.Flags().StringVar(&formatSeparator, "formatSeparator", "\n", "Separator between messages")
 	copyCmd.Flags().StringVar(&formatPostfix, "formatPostfix", "", "Post-fix value for the message list")
+	copyCmd.Flags().BoolVar(&toExchange, "exchange", false, "Publish to the destination as an exchange instead of a queue")
+	copyCmd.Flags().StringVar(&routingKey, "routing-key", "", "Routing key when publishing to an exchange (requires --exchange, default the original routing key)")
+	copyCmd.Flags().StringVar(&srcURI, "src-uri", "", "AMQP URI of the origin broker (default the global connection settings)")
+	copyCmd.Flags().StringVar(&srcProfile, "src-profile", "", "Config profile of the origin broker, over the global connection settings")
+	copyCmd.Flags().StringVar(&dstURI, "dst-uri", "", "AMQP URI of the destiny broker (default the origin broker)")
+	copyCmd.Flags().StringVar(&dstProfile, "dst-profile", "", "Config profile of the destiny broker, over the global connection settings")
+	copyCmd.Flags().IntVar(&reconnectAttempts, "reconnect-attempts", 0, "Attempts to reconnect a lost origin or destiny connection (0 for no reconnection)")
+	copyCmd.Flags().DurationVar(&reconnectDelay, "reconnect-delay", 5*time.Second, "Delay before every reconnection attempt")
+	copyCmd.Flags().StringVar(&routingKeyHeader, "routing-key-header", "", "Header with the routing key when publishing to an exchange (requires --exchange, if the message has it)")
 }
@@ -14,19 +14,40 @@
 package cmd
 
 import (
-	"github.com/rormartin/amqp-go-tool/internal/pkg/amqpcmds"
+	"context"
+	"fmt"
+	"github.com/rormartin/amqp-go-tool/pkg/amqptool"
 	"github.com/spf13/cobra"
+	"io/ioutil"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
 	autoAck         bool
+	snapshot        bool
 	prefetch        int
 	count           int
+	untilEmpty      bool
+	idleTimeout     time.Duration
 	file            string
+	format          string
 	formatPrefix    string
 	formatSeparator string
 	formatPostfix   string
+	where           []string
+	templateText    string
+	templateFile    string
+	columns         []string
+	compress        string
+	splitEvery      int
+	splitSize       string
+	splitInterval   time.Duration
+	splitTimestamp  bool
+	dir             string
+	fileName        string
 )
 
 // exportCmd represents the export command
@@ -36,37 +57,122 @@ var exportCmd = &cobra.Command{
 	Long: `Export the messages from a RabbitMQ queue to the stdout or to a file.
 
 Prefix, post-fix and custom message separators are available for
-custom formatting.  `,
+custom formatting. The jsonl format writes every message as a JSON
+envelope with the routing information, properties, typed headers and
+the body (UTF-8 or base64), so it can be used as a backup.
+
+With --split-every, --split-size or --split-interval the output is
+split in numbered files (orders.jsonl in orders-00001.jsonl, ...),
+every one with the prefix and post-fix, and a manifest
+(orders.manifest.json) lists the files and their messages.
+
+With --dir every message body is written in its own file, named with
+the --file-name template and the extension of its content type, next
+to a .meta.json file with its routing information, properties and
+headers. The directory must be empty or not exist. The import command
+reads the directory back.
+
+With --template (or --template-file) every message is rendered with a
+Go text/template, to generate CSV, SQL or scripts from a queue. The
+rendered messages are written with the prefix, separator and post-fix.
+The template data are .Index, .Exchange, .RoutingKey, .Redelivered,
+.Headers, the properties (.ContentType, .MessageId, .Timestamp,
+.AppId, ...), .Body (raw), .Text (string) and .JSON (parsed body),
+and the helpers base64, json, toUpper, toLower, trim, replace,
+default, path, formatTime, unixTime, csv, sqlString and shellQuote.  `,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		queue := args[0]
-		amcmd := amqpcmds.NewCommandInfo(
-			username,
-			password,
-			host,
-			port,
-			autoAck,
-			prefetch,
-			count,
-			file,
-			formatPrefix,
-			formatSeparator,
-			formatPostfix,
-		)
-		err := amcmd.CommandExport(queue)
+		filters, err := filterOption()
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts := consumeOptions(amqptool.WithAutoACK(autoAck), amqptool.WithSnapshot(snapshot), filters)
+		tmpl, err := readTemplate()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if tmpl != "" {
+			opts = append(opts, amqptool.WithTemplate(tmpl))
+		}
+		size, err := parseSize(splitSize)
 		if err != nil {
 			log.Fatal(err)
 		}
+		opts = append(opts, amqptool.WithSplitEvery(splitEvery), amqptool.WithSplitSize(size),
+			amqptool.WithSplitInterval(splitInterval), amqptool.WithSplitTimestamp(splitTimestamp))
+		if dir != "" {
+			opts = append(opts, amqptool.WithDirectory(dir), amqptool.WithFileName(fileName))
+		}
+		amcmd := amqptool.NewCommandInfo(opts...)
+		runCommand(amcmd, func(ctx context.Context) error {
+			return amcmd.CommandExportContext(ctx, queue)
+		})
 	}}
 
 func init() {
 	rootCmd.AddCommand(exportCmd)
 
 	exportCmd.Flags().StringVar(&file, "file", "", "Output file for messages (no value for stdout)")
+	exportCmd.Flags().StringVar(&compress, "compress", "", "Compress the output: gzip, zstd or none (default from the file extension: .gz, .zst or .zstd)")
+	exportCmd.Flags().IntVar(&splitEvery, "split-every", 0, "Split the output in files of these messages (0 for no split)")
+	exportCmd.Flags().StringVar(&splitSize, "split-size", "", "Split the output in files of this size before compression, e.g. 100MB (KB, MB and GB are powers of 1024)")
+	exportCmd.Flags().DurationVar(&splitInterval, "split-interval", 0, "Split the output in files covering this duration, e.g. 1h (0 for no split)")
+	exportCmd.Flags().BoolVar(&splitTimestamp, "split-timestamp", false, "Add the creation time to the names of the split files")
+	exportCmd.Flags().StringVar(&dir, "dir", "", "Write every message in its own file of the directory, with a .meta.json sidecar (instead of --file)")
+	exportCmd.Flags().StringVar(&fileName, "file-name", amqptool.DefaultFileName, "Go text/template of the file names of --dir, e.g. {{.MessageId}} or {{index .Headers \"x-tenant\"}}-{{.Index}}")
 	exportCmd.Flags().IntVar(&count, "count", 0, "Messages to export (0 for keep waiting for messages)")
+	exportCmd.Flags().BoolVar(&untilEmpty, "until-empty", false, "Stop once the messages in the queue at start are processed (implies --snapshot without --auto-ack)")
+	exportCmd.Flags().DurationVar(&idleTimeout, "idle-timeout", 0, "Stop when no message arrives for the given duration, e.g. 30s (0 for keep waiting)")
 	exportCmd.Flags().IntVar(&prefetch, "prefetch", 1, "Prefetch value to consumer messages")
 	exportCmd.Flags().BoolVar(&autoAck, "auto-ack", false, "Auto ACK the messages after exported")
+	exportCmd.Flags().BoolVar(&snapshot, "snapshot", false, "Export the messages in the queue at start, leaving them in the same order (ignored with --auto-ack)")
+	exportCmd.Flags().StringArrayVar(&where, "where", nil, whereUsage)
+	exportCmd.Flags().StringVar(&format, "format", amqptool.FormatRaw, "Output format: raw (message bodies with prefix, separator and post-fix), jsonl (one JSON message envelope per line), csv (a row with the --columns per message) or template (implied by --template)")
+	exportCmd.Flags().StringSliceVar(&columns, "columns", amqptool.DefaultColumns, "Columns of the csv format: message properties (message_id, timestamp, routing_key, ...), headers.NAME, body or body.PATH for JSON body fields, as in --where")
+	exportCmd.Flags().StringVar(&templateText, "template", "", "Go text/template to render every message")
+	exportCmd.Flags().StringVar(&templateFile, "template-file", "", "File with the Go text/template to render every message")
 	exportCmd.Flags().StringVar(&formatPrefix, "formatPrefix", "", "Prefix value for the message list")
 	exportCmd.Flags().StringVar(&formatSeparator, "formatSeparator", "\n", "Separator between messages")
 	exportCmd.Flags().StringVar(&formatPostfix, "formatPostfix", "", "Post-fix value for the message list")
 }
+
+// readTemplate returns the template of the --template or the
+// --template-file flag, if any
+func readTemplate() (string, error) {
+	if templateFile == "" {
+		return templateText, nil
+	}
+	if templateText != "" {
+		return "", fmt.Errorf("Only one of --template and --template-file can be used")
+	}
+	data, err := ioutil.ReadFile(templateFile)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read the template file: %v", err)
+	}
+	return string(data), nil
+}
+
+// parseSize parses a size in bytes with an optional unit: B, KB, MB
+// or GB (powers of 1024)
+func parseSize(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	units := []struct {
+		suffix string
+		factor int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	number, factor := strings.ToUpper(strings.TrimSpace(value)), int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(number, u.suffix) {
+			number, factor = strings.TrimSpace(strings.TrimSuffix(number, u.suffix)), u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid size %q, e.g. 100MB", value)
+	}
+	return n * factor, nil
+}
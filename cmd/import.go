@@ -0,0 +1,79 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"log"
+
+	"github.com/rormartin/amqp-go-tool/pkg/amqptool"
+	"github.com/spf13/cobra"
+)
+
+var (
+	toExchange       bool
+	routingKey       string
+	routingKeyHeader string
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import [file_or_dir] [queue-or-exchange]",
+	Short: "Import the messages of an exported file into RabbitMQ",
+	Long: `Import the messages of an exported file into a queue or an exchange.
+
+The jsonl format restores the properties and headers of every message;
+the raw format splits the message bodies using the prefix, post-fix and
+separator values. With --exchange the messages are published to the
+exchange with the routing key of the --routing-key-header header, the
+--routing-key value or their original routing key, in that order.
+
+Files compressed with gzip or zstd are decompressed transparently. A
+directory written by export --dir is imported with the metadata of
+every message, in the order of the file names.  `,
+
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		src := args[0]
+		dst := args[1]
+		opts := []amqptool.Option{
+			amqptool.WithConnection(connection),
+			amqptool.WithCount(count),
+			amqptool.WithFormat(format),
+			amqptool.WithRawFormat(formatPrefix, formatSeparator, formatPostfix),
+		}
+		publish, err := publishOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, publish...)
+		amcmd := amqptool.NewCommandInfo(opts...)
+		runCommand(amcmd, func(ctx context.Context) error {
+			return amcmd.CommandImportContext(ctx, src, dst)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().IntVar(&count, "count", 0, "Messages to import (0 for all the messages in the file)")
+	importCmd.Flags().StringVar(&format, "format", amqptool.FormatRaw, "Input format: raw (message bodies with prefix, separator and post-fix) or jsonl (one JSON message envelope per line)")
+	importCmd.Flags().StringVar(&formatPrefix, "formatPrefix", "", "Prefix value for the message list")
+	importCmd.Flags().StringVar(&formatSeparator, "formatSeparator", "\n", "Separator between messages")
+	importCmd.Flags().StringVar(&formatPostfix, "formatPostfix", "", "Post-fix value for the message list")
+	importCmd.Flags().BoolVar(&toExchange, "exchange", false, "Publish to the destination as an exchange instead of a queue")
+	importCmd.Flags().StringVar(&routingKey, "routing-key", "", "Routing key when publishing to an exchange (requires --exchange, default the original routing key)")
+	importCmd.Flags().StringVar(&routingKeyHeader, "routing-key-header", "", "Header with the routing key when publishing to an exchange (requires --exchange, if the message has it)")
+}
@@ -14,42 +14,55 @@
 package cmd
 
 import (
+	"context"
 	"log"
+	"time"
 
-	"github.com/rormartin/amqp-go-tool/internal/pkg/amqpcmds"
+	"github.com/rormartin/amqp-go-tool/pkg/amqptool"
 	"github.com/spf13/cobra"
 )
 
 // moveCmd represents the move command
 var moveCmd = &cobra.Command{
-	Use:   "move [origin_queue] [destiny_queue]",
+	Use:   "move [origin_queue] [destiny_queue_or_exchange]",
 	Short: "Move messages from one queue to another one",
 	Long: `Move messages from one queue to another one.
 
 The messages processed are also written in a external file (or stdout
-if file is not specified).  `,
+if file is not specified). Every message is only removed from the
+origin queue once the broker confirms its publication in the destiny
+queue, and it is kept in the origin queue if the broker can't route it.
+
+With --exchange the messages are published to the exchange with the
+routing key of the --routing-key-header header, the --routing-key
+value or their original routing key, in that order.  `,
 
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		src := args[0]
 		dst := args[1]
-		amcmd := amqpcmds.NewCommandInfo(
-			username,
-			password,
-			host,
-			port,
-			true,
-			prefetch,
-			count,
-			file,
-			formatPrefix,
-			formatSeparator,
-			formatPostfix,
-		)
-		err := amcmd.CommandCopyMoveToQueue(src, dst)
+		shovel, err := shovelOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		filters, err := filterOption()
+		if err != nil {
+			log.Fatal(err)
+		}
+		rewrite, err := rewriteOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		publish, err := publishOptions()
 		if err != nil {
 			log.Fatal(err)
 		}
+		opts := append(consumeOptions(amqptool.WithAutoACK(true), filters), publish...)
+		opts = append(opts, rewrite...)
+		amcmd := amqptool.NewCommandInfo(append(opts, shovel...)...)
+		runCommand(amcmd, func(ctx context.Context) error {
+			return amcmd.CommandCopyMoveToQueueContext(ctx, src, dst)
+		})
 	},
 }
 
@@ -57,9 +70,25 @@ func init() {
 	rootCmd.AddCommand(moveCmd)
 
 	moveCmd.Flags().StringVar(&file, "file", "", "Output file for messages (no value for stdout)")
+	moveCmd.Flags().StringVar(&compress, "compress", "", "Compress the output: gzip, zstd or none (default from the file extension: .gz, .zst or .zstd)")
 	moveCmd.Flags().IntVar(&count, "count", 0, "Messages to export (0 for keep waiting for messages)")
+	moveCmd.Flags().BoolVar(&untilEmpty, "until-empty", false, "Stop once the messages in the queue at start are processed")
+	moveCmd.Flags().DurationVar(&idleTimeout, "idle-timeout", 0, "Stop when no message arrives for the given duration, e.g. 30s (0 for keep waiting)")
 	moveCmd.Flags().IntVar(&prefetch, "prefetch", 1, "Prefetch value to consumer messages")
+	moveCmd.Flags().StringArrayVar(&where, "where", nil, whereUsage)
+	addRewriteFlags(moveCmd)
+	moveCmd.Flags().StringVar(&format, "format", amqptool.FormatRaw, "Output format: raw (message bodies with prefix, separator and post-fix), jsonl (one JSON message envelope per line) or csv (a row with the --columns per message)")
+	moveCmd.Flags().StringSliceVar(&columns, "columns", amqptool.DefaultColumns, "Columns of the csv format: message properties (message_id, timestamp, routing_key, ...), headers.NAME, body or body.PATH for JSON body fields, as in --where")
 	moveCmd.Flags().StringVar(&formatPrefix, "formatPrefix", "", "Prefix value for the message list")
 	moveCmd.Flags().StringVar(&formatSeparator, "formatSeparator", "\n", "Separator between messages")
 	moveCmd.Flags().StringVar(&formatPostfix, "formatPostfix", "", "Post-fix value for the message list")
+	moveCmd.Flags().BoolVar(&toExchange, "exchange", false, "Publish to the destination as an exchange instead of a queue")
+	moveCmd.Flags().StringVar(&routingKey, "routing-key", "", "Routing key when publishing to an exchange (requires --exchange, default the original routing key)")
+	moveCmd.Flags().StringVar(&srcURI, "src-uri", "", "AMQP URI of the origin broker (default the global connection settings)")
+	moveCmd.Flags().StringVar(&srcProfile, "src-profile", "", "Config profile of the origin broker, over the global connection settings")
+	moveCmd.Flags().StringVar(&dstURI, "dst-uri", "", "AMQP URI of the destiny broker (default the origin broker)")
+	moveCmd.Flags().StringVar(&dstProfile, "dst-profile", "", "Config profile of the destiny broker, over the global connection settings")
+	moveCmd.Flags().IntVar(&reconnectAttempts, "reconnect-attempts", 0, "Attempts to reconnect a lost origin or destiny connection (0 for no reconnection)")
+	moveCmd.Flags().DurationVar(&reconnectDelay, "reconnect-delay", 5*time.Second, "Delay before every reconnection attempt")
+	moveCmd.Flags().StringVar(&routingKeyHeader, "routing-key-header", "", "Header with the routing key when publishing to an exchange (requires --exchange, if the message has it)")
 }
@@ -0,0 +1,64 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/rormartin/amqp-go-tool/pkg/amqptool"
+	"github.com/spf13/cobra"
+)
+
+var (
+	peekCount int
+	peekJSON  bool
+)
+
+// peekCmd represents the peek command
+var peekCmd = &cobra.Command{
+	Use:   "peek [queue]",
+	Short: "Show the first messages of a queue without consuming them",
+	Long: `Show the first messages of a queue without consuming them.
+
+The messages are fetched one by one and printed as a table (index,
+message id, routing key, content type, size, redelivered flag,
+headers and body, truncated), or as jsonl envelopes with --json. At the
+end all of them are requeued: the queue keeps the same messages, but
+they are marked as redelivered.  `,
+
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		queue := args[0]
+		peekFormat := amqptool.FormatTable
+		if peekJSON {
+			peekFormat = amqptool.FormatJSONL
+		}
+		amcmd := amqptool.NewCommandInfo(
+			amqptool.WithConnection(connection),
+			amqptool.WithCount(peekCount),
+			amqptool.WithFile(file),
+			amqptool.WithFormat(peekFormat))
+		runCommand(amcmd, func(ctx context.Context) error {
+			return amcmd.CommandPeekContext(ctx, queue)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(peekCmd)
+
+	peekCmd.Flags().IntVarP(&peekCount, "count", "n", 10, "Messages to show (0 for all the messages in the queue)")
+	peekCmd.Flags().BoolVar(&peekJSON, "json", false, "Print a JSON message envelope per line instead of the table")
+	peekCmd.Flags().StringVar(&file, "file", "", "Output file for messages (no value for stdout)")
+}
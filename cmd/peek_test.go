@@ -0,0 +1,36 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeekCount(t *testing.T) {
+	defer func() {
+		peekCount, count = 10, 0
+	}()
+
+	// the default survives the init of the commands sharing count
+	n, err := peekCmd.Flags().GetInt("count")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, 10, peekCount)
+
+	assert.NoError(t, peekCmd.ParseFlags([]string{"-n", "3"}))
+	assert.Equal(t, 3, peekCount)
+	assert.Equal(t, 0, count)
+}
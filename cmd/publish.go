@@ -0,0 +1,139 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rormartin/amqp-go-tool/pkg/amqptool"
+	"github.com/spf13/cobra"
+	"github.com/streadway/amqp"
+)
+
+var (
+	bodyFile   string
+	headers    []string
+	persistent bool
+	repeat     int
+	rate       float64
+)
+
+// publishProperties are the flags of the message properties, named as
+// the properties with dashes
+var publishProperties = []string{
+	"content-type", "content-encoding", "correlation-id", "reply-to", "expiration",
+	"priority", "message-id", "timestamp", "type", "user-id", "app-id",
+}
+
+// publishCmd represents the publish command
+var publishCmd = &cobra.Command{
+	Use:   "publish [exchange] [routing_key] [body]",
+	Short: "Publish a message to an exchange",
+	Long: `Publish a message to an exchange ("" for the default exchange,
+with the queue name as routing key).
+
+The body is the argument, the content of --body-file or, without
+both, the standard input. The message properties are set with their
+flags and the headers with --header; --repeat publishes the message
+several times, at most --rate messages per second.  `,
+
+	Args: cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		exchange := args[0]
+		key := args[1]
+		body, err := readBody(args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts := []amqptool.Option{
+			amqptool.WithConnection(connection),
+			amqptool.WithRepeat(repeat),
+			amqptool.WithRate(rate),
+		}
+		for _, expr := range headers {
+			name, value, err := amqptool.ParseHeader(expr)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts = append(opts, amqptool.WithSetHeader(name, value))
+		}
+		if persistent {
+			opts = append(opts, amqptool.WithProperty("delivery_mode", "2"))
+		}
+		for _, name := range publishProperties {
+			if f := cmd.Flags().Lookup(name); f.Changed {
+				property := strings.Replace(name, "-", "_", -1)
+				if err := amqptool.ValidateProperty(property, f.Value.String()); err != nil {
+					log.Fatal(err)
+				}
+				opts = append(opts, amqptool.WithProperty(property, f.Value.String()))
+			}
+		}
+
+		amcmd := amqptool.NewCommandInfo(opts...)
+		runCommand(amcmd, func(ctx context.Context) error {
+			return amcmd.CommandPublishContext(ctx, exchange, key, amqp.Publishing{Body: body})
+		})
+	},
+}
+
+// readBody returns the body of the argument, the --body-file or the
+// standard input
+func readBody(args []string) ([]byte, error) {
+	if len(args) > 0 {
+		if bodyFile != "" {
+			return nil, fmt.Errorf("The body can't be both an argument and a --body-file")
+		}
+		return []byte(args[0]), nil
+	}
+	if bodyFile != "" && bodyFile != "-" {
+		body, err := ioutil.ReadFile(bodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the body file: %v", err)
+		}
+		return body, nil
+	}
+	body, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the body from stdin: %v", err)
+	}
+	return body, nil
+}
+
+func init() {
+	rootCmd.AddCommand(publishCmd)
+
+	publishCmd.Flags().StringVar(&bodyFile, "body-file", "", "File with the message body (- for stdin)")
+	publishCmd.Flags().StringArrayVar(&headers, "header", nil, "Message header, name=value or name:type=value with type bool, byte, int16, int32, int64, float32, float64, timestamp or void (repeatable)")
+	publishCmd.Flags().String("content-type", "", "Content type of the body, e.g. application/json")
+	publishCmd.Flags().String("content-encoding", "", "Content encoding of the body, e.g. gzip")
+	publishCmd.Flags().String("correlation-id", "", "Correlation id of the message")
+	publishCmd.Flags().String("reply-to", "", "Queue to reply to")
+	publishCmd.Flags().String("expiration", "", "Message TTL in milliseconds, e.g. 60000")
+	publishCmd.Flags().Uint8("priority", 0, "Message priority, for queues with x-max-priority")
+	publishCmd.Flags().BoolVar(&persistent, "persistent", false, "Publish the message as persistent (delivery mode 2)")
+	publishCmd.Flags().String("message-id", "", "Message id")
+	publishCmd.Flags().String("timestamp", "", "Message timestamp, RFC 3339 time or date")
+	publishCmd.Flags().String("type", "", "Message type")
+	publishCmd.Flags().String("user-id", "", "User id of the message (the broker checks it is the connection user)")
+	publishCmd.Flags().String("app-id", "", "Id of the publishing application")
+	publishCmd.Flags().IntVar(&repeat, "repeat", 1, "Times to publish the message")
+	publishCmd.Flags().Float64Var(&rate, "rate", 0, "Maximum messages published per second (0 for no limit)")
+}
@@ -0,0 +1,99 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/rormartin/amqp-go-tool/pkg/amqptool"
+	"github.com/spf13/cobra"
+)
+
+var (
+	deathReasons   []string
+	maxDeaths      int
+	stripDeaths    bool
+	redriveToQueue bool
+)
+
+// redriveCmd represents the redrive command
+var redriveCmd = &cobra.Command{
+	Use:   "redrive [dead_letter_queue]",
+	Short: "Move dead-lettered messages back to where they died from",
+	Long: `Move dead-lettered messages back to where they died from.
+
+Every message is published to the exchange and routing key it was
+published with before dying, or to the queue it died from with
+--to-queue, as recorded by the broker in its x-death header. Messages
+without x-death, or not matching --reason, --max-deaths and --where,
+are left in the dead-letter queue.
+
+The messages processed are also written in a external file (or stdout
+if file is not specified). As with move, every message is only
+removed from the dead-letter queue once the broker confirms its
+publication.  `,
+
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		queue := args[0]
+		shovel, err := shovelOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		filters, err := filterOption()
+		if err != nil {
+			log.Fatal(err)
+		}
+		rewrite, err := rewriteOptions()
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts := append(consumeOptions(amqptool.WithAutoACK(true), filters,
+			amqptool.WithDeathReasons(deathReasons...),
+			amqptool.WithMaxDeaths(maxDeaths),
+			amqptool.WithStripDeaths(stripDeaths),
+			amqptool.WithRedriveToQueue(redriveToQueue)), shovel...)
+		opts = append(opts, rewrite...)
+		amcmd := amqptool.NewCommandInfo(opts...)
+		runCommand(amcmd, func(ctx context.Context) error {
+			return amcmd.CommandRedriveContext(ctx, queue)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(redriveCmd)
+
+	redriveCmd.Flags().StringVar(&file, "file", "", "Output file for messages (no value for stdout)")
+	redriveCmd.Flags().StringVar(&compress, "compress", "", "Compress the output: gzip, zstd or none (default from the file extension: .gz, .zst or .zstd)")
+	redriveCmd.Flags().IntVar(&count, "count", 0, "Messages to redrive (0 for keep waiting for messages)")
+	redriveCmd.Flags().BoolVar(&untilEmpty, "until-empty", false, "Stop once the messages in the queue at start are processed")
+	redriveCmd.Flags().DurationVar(&idleTimeout, "idle-timeout", 0, "Stop when no message arrives for the given duration, e.g. 30s (0 for keep waiting)")
+	redriveCmd.Flags().IntVar(&prefetch, "prefetch", 1, "Prefetch value to consumer messages")
+	redriveCmd.Flags().StringSliceVar(&deathReasons, "reason", nil, "Redrive only the messages dead-lettered for these reasons: rejected, expired, maxlen or delivery_limit (default all)")
+	redriveCmd.Flags().IntVar(&maxDeaths, "max-deaths", 0, "Redrive only the messages dead-lettered at most these times (0 for no limit)")
+	redriveCmd.Flags().BoolVar(&stripDeaths, "strip-deaths", false, "Remove the x-death history from the redriven messages (by default it is kept and the broker keeps counting)")
+	redriveCmd.Flags().BoolVar(&redriveToQueue, "to-queue", false, "Publish to the queue the message died from instead of its original exchange and routing key")
+	redriveCmd.Flags().StringArrayVar(&where, "where", nil, whereUsage)
+	addRewriteFlags(redriveCmd)
+	redriveCmd.Flags().StringVar(&format, "format", amqptool.FormatRaw, "Output format: raw (message bodies with prefix, separator and post-fix), jsonl (one JSON message envelope per line) or csv (a row with the --columns per message)")
+	redriveCmd.Flags().StringSliceVar(&columns, "columns", amqptool.DefaultColumns, "Columns of the csv format: message properties (message_id, timestamp, routing_key, ...), headers.NAME, body or body.PATH for JSON body fields, as in --where")
+	redriveCmd.Flags().StringVar(&formatPrefix, "formatPrefix", "", "Prefix value for the message list")
+	redriveCmd.Flags().StringVar(&formatSeparator, "formatSeparator", "\n", "Separator between messages")
+	redriveCmd.Flags().StringVar(&formatPostfix, "formatPostfix", "", "Post-fix value for the message list")
+	redriveCmd.Flags().IntVar(&reconnectAttempts, "reconnect-attempts", 0, "Attempts to reconnect a lost connection (0 for no reconnection)")
+	redriveCmd.Flags().DurationVar(&reconnectDelay, "reconnect-delay", 5*time.Second, "Delay before every reconnection attempt")
+}
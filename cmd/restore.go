@@ -0,0 +1,66 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/rormartin/amqp-go-tool/pkg/amqptool"
+	"github.com/spf13/cobra"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore [archive] [queue[=new_name]...]",
+	Short: "Publish the messages of a backup archive to their queues",
+	Long: `Publish the messages of a backup archive to their queues.
+
+All the queues of the archive are restored, or only the ones given,
+optionally into another queue with queue=new_name (two queues can't
+be restored into the same one). The checksums of the archive are
+verified before publishing any message. The queues with a definition
+in the archive (see backup --management-url) are declared with it,
+the rest must exist. The messages are published with publisher
+confirms, and the restore stops at the first one the broker doesn't
+confirm.  `,
+
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		archive := args[0]
+		queues := map[string]string{}
+		for _, arg := range args[1:] {
+			name, target := arg, ""
+			if i := strings.Index(arg, "="); i >= 0 {
+				name, target = arg[:i], arg[i+1:]
+			}
+			if name == "" {
+				log.Fatalf("Invalid queue %q: expected queue or queue=new_name", arg)
+			}
+			if _, ok := queues[name]; ok {
+				log.Fatalf("Queue %q given more than once", name)
+			}
+			queues[name] = target
+		}
+		amcmd := amqptool.NewCommandInfo(amqptool.WithConnection(connection))
+		runCommand(amcmd, func(ctx context.Context) error {
+			return amcmd.CommandRestoreContext(ctx, archive, queues)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
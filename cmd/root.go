@@ -14,22 +14,50 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	homedir "github.com/mitchellh/go-homedir"
+	"github.com/rormartin/amqp-go-tool/pkg/amqptool"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
-	cfgFile  string
-	host     string
-	port     int
-	username string
-	password string
+	cfgFile    string
+	profile    string
+	timeout    time.Duration
+	connection amqptool.ConnectionSettings
+
+	// copy and move source and destination overrides
+	srcURI            string
+	srcProfile        string
+	dstURI            string
+	dstProfile        string
+	reconnectAttempts int
+	reconnectDelay    time.Duration
+
+	// copy, move and redrive message rewriting
+	setHeaders    []string
+	deleteHeaders []string
+	renameHeaders []string
+	setProperties []string
+	provenance    bool
 )
 
+// connectionKeys are the global flags that can also be defined with
+// environment variables (AMQP_GO_TOOL_ prefix) or in a config profile
+var connectionKeys = []string{
+	"uri", "host", "port", "username", "password", "vhost",
+	"tls", "tls-ca-cert", "tls-cert", "tls-key", "tls-server-name", "tls-insecure-skip-verify",
+}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:     "amqp-go-tool",
@@ -55,15 +83,165 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.amqp-go-tool.yaml)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Connection profile from the config file")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "Maximum run time of the command, e.g. 5m (0 for no limit)")
+
+	rootCmd.PersistentFlags().StringVar(&connection.URI, "uri", "", "Full amqp:// or amqps:// URI (overrides host, port, username, password and vhost)")
+	rootCmd.PersistentFlags().StringVar(&connection.Host, "host", "localhost", "RabbitMQ host name")
+	rootCmd.PersistentFlags().IntVar(&connection.Port, "port", 0, "RabbitMQ port (default 5672, or 5671 with TLS)")
+	rootCmd.PersistentFlags().StringVar(&connection.Username, "username", "guest", "RabbitMQ username")
+	rootCmd.PersistentFlags().StringVar(&connection.Password, "password", "guest", "RabbitMQ password")
+	rootCmd.PersistentFlags().StringVar(&connection.Vhost, "vhost", "/", "RabbitMQ virtual host")
+
+	rootCmd.PersistentFlags().BoolVar(&connection.TLS.Enabled, "tls", false, "Connect using TLS (amqps)")
+	rootCmd.PersistentFlags().StringVar(&connection.TLS.CACertFile, "tls-ca-cert", "", "CA bundle file to verify the server certificate (implies --tls)")
+	rootCmd.PersistentFlags().StringVar(&connection.TLS.CertFile, "tls-cert", "", "Client certificate file (implies --tls)")
+	rootCmd.PersistentFlags().StringVar(&connection.TLS.KeyFile, "tls-key", "", "Client private key file (implies --tls)")
+	rootCmd.PersistentFlags().StringVar(&connection.TLS.ServerName, "tls-server-name", "", "Server name to verify in the server certificate (implies --tls)")
+	rootCmd.PersistentFlags().BoolVar(&connection.TLS.InsecureSkipVerify, "tls-insecure-skip-verify", false, "Skip the server certificate verification (implies --tls)")
 
-	rootCmd.PersistentFlags().StringVar(&host, "host", "localhost", "RabbitMQ host name")
-	rootCmd.PersistentFlags().IntVar(&port, "port", 5672, "RabbitMQ port")
-	rootCmd.PersistentFlags().StringVar(&username, "username", "guest", "RabbitMQ username")
-	rootCmd.PersistentFlags().StringVar(&password, "password", "guest", "RabbitMQ password")
+	bindConnectionFlags()
+}
 
+// bindConnectionFlags binds the connection flags to the config keys
+func bindConnectionFlags() {
+	for _, key := range append(connectionKeys, "profile") {
+		viper.BindPFlag(key, rootCmd.PersistentFlags().Lookup(key))
+	}
 }
 
-// initConfig reads in config file and ENV variables if set.
+// runCommand executes the command function, interrupting it
+// gracefully on SIGINT/SIGTERM (a second signal exits immediately) and
+// bounding it with the timeout, and prints the summary of processed
+// messages.
+func runCommand(amcmd amqptool.AmqpCommand, run func(ctx context.Context) error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		fmt.Fprintln(os.Stderr, "Interrupted, finishing...")
+		amcmd.Interrupt()
+		<-signals
+		os.Exit(1)
+	}()
+
+	err := run(ctx)
+	fmt.Fprintf(os.Stderr, "%d messages processed\n", amcmd.Processed())
+	if cerr, ok := err.(*amqptool.CanceledError); ok && cerr.Err == context.DeadlineExceeded {
+		log.Fatalf("Timeout of %v reached", timeout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// consumeOptions returns the command options for the flags shared by
+// the commands consuming from a queue, followed by the extra ones
+func consumeOptions(extra ...amqptool.Option) []amqptool.Option {
+	opts := []amqptool.Option{
+		amqptool.WithConnection(connection),
+		amqptool.WithPrefetch(prefetch),
+		amqptool.WithCount(count),
+		amqptool.WithUntilEmpty(untilEmpty),
+		amqptool.WithIdleTimeout(idleTimeout),
+		amqptool.WithFile(file),
+		amqptool.WithCompression(compress),
+		amqptool.WithFormat(format),
+		amqptool.WithRawFormat(formatPrefix, formatSeparator, formatPostfix),
+		amqptool.WithColumns(columns...),
+	}
+	return append(opts, extra...)
+}
+
+// whereUsage is the help of the --where flag of the consuming commands
+var whereUsage = fmt.Sprintf("Process only the messages matching the condition field=value, field!=value, field~regexp, field!~regexp, field<value, field<=value, field>value or field>=value (repeat it to require all of them). The other messages are held unacked and requeued at the end; without a snapshot, the command fails once %d are held", amqptool.DefaultMaxHeld)
+
+// filterOption returns the command option with the --where conditions
+func filterOption() (amqptool.Option, error) {
+	filters := make([]amqptool.Filter, 0, len(where))
+	for _, expr := range where {
+		f, err := amqptool.ParseFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return amqptool.WithFilters(filters...), nil
+}
+
+// rewriteOptions returns the command options for the header and
+// property rewriting flags: the headers are renamed, then deleted and
+// then set
+func rewriteOptions() ([]amqptool.Option, error) {
+	opts := []amqptool.Option{amqptool.WithProvenance(provenance)}
+	for _, expr := range renameHeaders {
+		i := strings.Index(expr, "=")
+		if i <= 0 || i == len(expr)-1 {
+			return nil, fmt.Errorf("Invalid header rename %q: expected old=new", expr)
+		}
+		opts = append(opts, amqptool.WithRenameHeader(expr[:i], expr[i+1:]))
+	}
+	for _, name := range deleteHeaders {
+		opts = append(opts, amqptool.WithDeleteHeader(name))
+	}
+	for _, expr := range setHeaders {
+		name, value, err := amqptool.ParseHeader(expr)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, amqptool.WithSetHeader(name, value))
+	}
+	for _, expr := range setProperties {
+		i := strings.Index(expr, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("Invalid property %q: expected name=value", expr)
+		}
+		if err := amqptool.ValidateProperty(expr[:i], expr[i+1:]); err != nil {
+			return nil, err
+		}
+		opts = append(opts, amqptool.WithProperty(expr[:i], expr[i+1:]))
+	}
+	return opts, nil
+}
+
+// addRewriteFlags defines the header and property rewriting flags of
+// the command
+func addRewriteFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&setHeaders, "set-header", nil, "Set a header, name=value or name:type=value with type bool, byte, int16, int32, int64, float32, float64, timestamp or void (repeatable)")
+	cmd.Flags().StringArrayVar(&deleteHeaders, "delete-header", nil, "Remove a header (repeatable)")
+	cmd.Flags().StringArrayVar(&renameHeaders, "rename-header", nil, "Rename a header, old=new (repeatable)")
+	cmd.Flags().StringArrayVar(&setProperties, "set-property", nil, "Override a property, name=value, e.g. expiration=60000, priority=5, delivery_mode=2 or app_id=replay (repeatable)")
+	cmd.Flags().BoolVar(&provenance, "provenance", false, "Add the source queue, exchange, routing key and time moved as x-amqp-go-tool-* headers")
+}
+
+// publishOptions returns the command options for the flags of the
+// commands publishing to a queue or an exchange. The routing key flags
+// require --exchange, as a queue is published with its name.
+func publishOptions() ([]amqptool.Option, error) {
+	if !toExchange {
+		if routingKey != "" || routingKeyHeader != "" {
+			return nil, fmt.Errorf("The --routing-key and --routing-key-header flags require --exchange")
+		}
+		return nil, nil
+	}
+	return []amqptool.Option{
+		amqptool.WithExchange(routingKey),
+		amqptool.WithRoutingKeyHeader(routingKeyHeader),
+	}, nil
+}
+
+// initConfig reads in config file and ENV variables if set, and
+// resolves the connection settings with the precedence: flag, ENV
+// variable, selected profile, top level config value and flag default.
+// A uri is discarded when a host setting has a higher precedence.
 func initConfig() {
 	if cfgFile != "" {
 		// Use config file from the flag.
@@ -72,19 +250,177 @@ func initConfig() {
 		// Find home directory.
 		home, err := homedir.Dir()
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 
-		// Search config in home directory with name ".amqp-go-tool-cobra" (without extension).
+		// Search config in home directory with name ".amqp-go-tool" (without extension).
 		viper.AddConfigPath(home)
-		viper.SetConfigName(".amqp-go-tool-cobra")
+		viper.SetConfigName(".amqp-go-tool")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// read in environment variables that match, e.g. AMQP_GO_TOOL_TLS_CA_CERT
+	viper.SetEnvPrefix("amqp_go_tool")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	} else if cfgFile != "" {
+		fmt.Fprintln(os.Stderr, "Error reading config file:", err)
+		os.Exit(1)
+	}
+
+	// A uri wins over the host settings of the same source, but not
+	// over the ones with a higher precedence
+	name := viper.GetString("profile")
+	dropURI := uriOverridden(name)
+
+	// The selected profile overrides the top level config values
+	if name != "" {
+		key := "profiles." + name
+		if !viper.IsSet(key) {
+			fmt.Fprintf(os.Stderr, "Profile %q not found in config file\n", name)
+			os.Exit(1)
+		}
+		if err := viper.MergeConfigMap(viper.GetStringMap(key)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error loading profile:", err)
+			os.Exit(1)
+		}
+	}
+
+	readConnection(viper.GetViper(), &connection)
+	if dropURI {
+		connection.URI = ""
+	}
+}
+
+// Sources of a global connection setting, by increasing precedence
+const (
+	fromUnset = iota
+	fromConfig
+	fromProfile
+	fromEnv
+	fromFlag
+)
+
+// settingSource returns where the global connection setting is
+// defined. It must be called before the profile is merged into the
+// top level config values.
+func settingSource(key, profileName string) int {
+	env := "AMQP_GO_TOOL_" + strings.ToUpper(strings.Replace(key, "-", "_", -1))
+	switch {
+	case rootCmd.PersistentFlags().Changed(key):
+		return fromFlag
+	case os.Getenv(env) != "":
+		return fromEnv
+	case profileName != "" && viper.IsSet("profiles."+profileName+"."+key):
+		return fromProfile
+	case viper.InConfig(key):
+		return fromConfig
+	}
+	return fromUnset
+}
+
+// uriOverridden reports whether any host setting has a higher
+// precedence than the uri, e.g. --host with a profile uri or a
+// profile host with a top level uri, so the uri must be discarded
+func uriOverridden(profileName string) bool {
+	uri := settingSource("uri", profileName)
+	for _, key := range hostKeys {
+		if settingSource(key, profileName) > uri {
+			return true
+		}
+	}
+	return false
+}
+
+// readConnection sets the connection settings defined in the config
+func readConnection(v *viper.Viper, s *amqptool.ConnectionSettings) {
+	if v.IsSet("uri") {
+		s.URI = v.GetString("uri")
+	}
+	if v.IsSet("host") {
+		s.Host = v.GetString("host")
+	}
+	if v.IsSet("port") {
+		s.Port = v.GetInt("port")
+	}
+	if v.IsSet("username") {
+		s.Username = v.GetString("username")
+	}
+	if v.IsSet("password") {
+		s.Password = v.GetString("password")
+	}
+	if v.IsSet("vhost") {
+		s.Vhost = v.GetString("vhost")
+	}
+	if v.IsSet("tls") {
+		s.TLS.Enabled = v.GetBool("tls")
+	}
+	if v.IsSet("tls-ca-cert") {
+		s.TLS.CACertFile = v.GetString("tls-ca-cert")
+	}
+	if v.IsSet("tls-cert") {
+		s.TLS.CertFile = v.GetString("tls-cert")
+	}
+	if v.IsSet("tls-key") {
+		s.TLS.KeyFile = v.GetString("tls-key")
+	}
+	if v.IsSet("tls-server-name") {
+		s.TLS.ServerName = v.GetString("tls-server-name")
+	}
+	if v.IsSet("tls-insecure-skip-verify") {
+		s.TLS.InsecureSkipVerify = v.GetBool("tls-insecure-skip-verify")
+	}
+}
+
+// hostKeys are the connection keys that a uri replaces
+var hostKeys = []string{"host", "port", "username", "password", "vhost"}
+
+// sideConnection resolves the connection settings of the source or
+// the destination of a copy or move: the global settings, overridden
+// by the values of the profile and by the uri. A profile with host
+// settings but no uri discards the global uri, that would win over
+// them.
+func sideConnection(profileName, uri string) (amqptool.ConnectionSettings, error) {
+	s := connection
+	if profileName != "" {
+		p := viper.Sub("profiles." + profileName)
+		if p == nil {
+			return s, fmt.Errorf("Profile %q not found in config file", profileName)
+		}
+		for _, key := range hostKeys {
+			if p.IsSet(key) && !p.IsSet("uri") {
+				s.URI = ""
+			}
+		}
+		readConnection(p, &s)
+	}
+	if uri != "" {
+		s.URI = uri
+	}
+	return s, nil
+}
+
+// shovelOptions returns the command options for the source and
+// destination connection flags of copy and move
+func shovelOptions() ([]amqptool.Option, error) {
+	src, err := sideConnection(srcProfile, srcURI)
+	if err != nil {
+		return nil, err
+	}
+	opts := []amqptool.Option{
+		amqptool.WithConnection(src),
+		amqptool.WithReconnect(reconnectAttempts, reconnectDelay),
+	}
+	if dstProfile != "" || dstURI != "" {
+		dst, err := sideConnection(dstProfile, dstURI)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, amqptool.WithDestination(dst))
 	}
+	return opts, nil
 }
@@ -3,6 +3,7 @@ module github.com/rormartin/amqp-go-tool
 require (
 	github.com/icemobilelab/amqp-go-tool v0.0.0-20180613142646-1ee7bb606e7b
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/klauspost/compress v1.9.7
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/spf13/cobra v0.0.3
 	github.com/spf13/pflag v1.0.5 // indirect
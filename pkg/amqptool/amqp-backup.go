@@ -0,0 +1,396 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// backupManifestFile is the first entry of a backup archive
+const backupManifestFile = "manifest.json"
+
+// BackupManifest describes the queues of a backup archive
+type BackupManifest struct {
+	Version int           `json:"version"`
+	Created time.Time     `json:"created"`
+	Queues  []BackupQueue `json:"queues"`
+}
+
+// BackupQueue is a queue of a backup archive, with the file of the
+// archive with its messages (a jsonl envelope per message), the number
+// of messages and the size and SHA-256 checksum of the file. The
+// definition of the queue is only known when it is read from the
+// management API (see WithManagementURL).
+type BackupQueue struct {
+	Name       string           `json:"name"`
+	File       string           `json:"file"`
+	Messages   int              `json:"messages"`
+	Bytes      int64            `json:"bytes"`
+	SHA256     string           `json:"sha256"`
+	Definition *QueueDefinition `json:"definition,omitempty"`
+}
+
+// CommandBackup snapshots the queues in a tar.gz archive, without
+// removing their messages (as WithSnapshot, whatever WithAutoACK and
+// WithCount): a manifest followed by the jsonl envelopes of every
+// queue. The messages not matching the filters are not included. With
+// WithManagementURL, the definitions of the queues (durability and
+// arguments) are also in the manifest. The archive is only created
+// once all the queues are read.
+func (c *CommandInfo) CommandBackup(archive string, queues ...string) error {
+	return c.CommandBackupContext(context.Background(), archive, queues...)
+}
+
+// CommandBackupContext snapshots the queues in a tar.gz archive until
+// the context is done.
+func (c *CommandInfo) CommandBackupContext(ctx context.Context, archive string, queues ...string) (err error) {
+	c.processed = 0
+	if len(queues) == 0 {
+		return fmt.Errorf("No queues to back up")
+	}
+	snapshot, autoACK, count := c.snapshot, c.autoACK, c.count
+	c.snapshot, c.autoACK, c.count = true, false, 0
+	defer func() {
+		c.snapshot, c.autoACK, c.count = snapshot, autoACK, count
+	}()
+
+	tmp, err := ioutil.TempDir(filepath.Dir(archive), ".backup")
+	if err != nil {
+		return fmt.Errorf("Failed to create the temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := c.source()
+	err = c.open(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer src.close()
+
+	manifest := BackupManifest{Version: 1, Created: time.Now().UTC().Truncate(time.Second)}
+	for i, queue := range queues {
+		q := BackupQueue{Name: queue, File: fmt.Sprintf("queues/%04d.jsonl", i+1)}
+		if c.managementURL != "" {
+			def, err := c.queueDefinition(ctx, queue)
+			if err != nil {
+				return err
+			}
+			q.Definition = &def
+		}
+		err = c.backupQueue(ctx, src, filepath.Join(tmp, filepath.Base(q.File)), &q)
+		if err != nil {
+			return err
+		}
+		manifest.Queues = append(manifest.Queues, q)
+		select {
+		case <-c.interrupted():
+			return fmt.Errorf("Backup interrupted, the archive was not created")
+		default:
+		}
+	}
+	return writeBackup(archive, tmp, manifest)
+}
+
+// backupQueue writes the snapshot of the queue in the file, and its
+// counters and checksum in the manifest entry
+func (c *CommandInfo) backupQueue(ctx context.Context, src *endpoint, file string, q *BackupQueue) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("Failed to create the temporary file: %v", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	bw := bufio.NewWriter(io.MultiWriter(f, hash))
+	size := &countingWriter{w: bw}
+	enc := json.NewEncoder(size)
+	enc.SetEscapeHTML(false)
+	w := &jsonlWriter{enc: enc}
+
+	_, err = c.consume(ctx, src, q.Name, nil, func(msg amqp.Delivery) error {
+		err := w.write(msg)
+		if err == nil {
+			q.Messages++
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Error backing up the queue %q: %v", q.Name, err)
+	}
+	if err = bw.Flush(); err != nil {
+		return fmt.Errorf("Error writing in file: %v", err)
+	}
+	q.Bytes = size.count
+	q.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return f.Close()
+}
+
+// writeBackup writes the archive with the manifest and the queue files
+// of the temporary directory. The archive is written in a temporary
+// file and renamed at the end, so a failure doesn't leave an archive.
+func writeBackup(archive, tmp string, manifest BackupManifest) (err error) {
+	part := filepath.Join(tmp, "archive")
+	f, err := os.Create(part)
+	if err != nil {
+		return fmt.Errorf("Failed to create the archive: %v", err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error encoding the manifest: %v", err)
+	}
+	err = writeTarEntry(tw, backupManifestFile, int64(len(data)), manifest.Created, bytes.NewReader(data))
+	for _, q := range manifest.Queues {
+		if err != nil {
+			break
+		}
+		var qf *os.File
+		qf, err = os.Open(filepath.Join(tmp, filepath.Base(q.File)))
+		if err != nil {
+			break
+		}
+		err = writeTarEntry(tw, q.File, q.Bytes, manifest.Created, qf)
+		qf.Close()
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("Error writing the archive: %v", err)
+	}
+	if err = os.Rename(part, archive); err != nil {
+		return fmt.Errorf("Failed to create the archive: %v", err)
+	}
+	return nil
+}
+
+func writeTarEntry(tw *tar.Writer, name string, size int64, modTime time.Time, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: modTime, Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, r)
+	return err
+}
+
+// openBackup opens the archive and reads its manifest, the first entry
+func openBackup(archive string) (*tar.Reader, BackupManifest, func(), error) {
+	var manifest BackupManifest
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, manifest, nil, fmt.Errorf("Failed to open the archive: %v", err)
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, manifest, nil, fmt.Errorf("Invalid archive: %v", err)
+	}
+	closer := func() {
+		gz.Close()
+		f.Close()
+	}
+
+	tr := tar.NewReader(gz)
+	hdr, err := tr.Next()
+	if err == nil && hdr.Name != backupManifestFile {
+		err = fmt.Errorf("the first entry is not the manifest")
+	}
+	if err == nil {
+		err = json.NewDecoder(tr).Decode(&manifest)
+	}
+	if err != nil {
+		closer()
+		return nil, manifest, nil, fmt.Errorf("Invalid archive: %v", err)
+	}
+	return tr, manifest, closer, nil
+}
+
+// verifyBackup checks the size and the checksum of every queue file of
+// the archive
+func verifyBackup(archive string) (BackupManifest, error) {
+	tr, manifest, closeArchive, err := openBackup(archive)
+	if err != nil {
+		return manifest, err
+	}
+	defer closeArchive()
+
+	files := map[string]BackupQueue{}
+	for _, q := range manifest.Queues {
+		files[q.File] = q
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, fmt.Errorf("Invalid archive: %v", err)
+		}
+		q, ok := files[hdr.Name]
+		if !ok {
+			continue
+		}
+		hash := sha256.New()
+		n, err := io.Copy(hash, tr)
+		if err != nil {
+			return manifest, fmt.Errorf("Invalid archive: %v", err)
+		}
+		if n != q.Bytes || hex.EncodeToString(hash.Sum(nil)) != q.SHA256 {
+			return manifest, fmt.Errorf("Invalid archive: checksum mismatch of the queue %q", q.Name)
+		}
+		delete(files, hdr.Name)
+	}
+	for _, q := range files {
+		return manifest, fmt.Errorf("Invalid archive: missing the messages of the queue %q", q.Name)
+	}
+	return manifest, nil
+}
+
+// CommandRestore publishes the messages of a backup archive to the
+// queues, after verifying the checksums of the archive. The queues map
+// selects the queues of the archive to restore (all of them if empty)
+// and renames them (to the same name when the value is empty), and two
+// queues can't be restored into the same one. The queues with a
+// definition in the archive are declared with it (it fails if they
+// exist with other arguments), the rest must exist. The messages are
+// published in confirm mode, and the restore stops at the first one
+// not confirmed by the broker.
+func (c *CommandInfo) CommandRestore(archive string, queues map[string]string) error {
+	return c.CommandRestoreContext(context.Background(), archive, queues)
+}
+
+// CommandRestoreContext publishes the messages of a backup archive to
+// the queues until the context is done.
+func (c *CommandInfo) CommandRestoreContext(ctx context.Context, archive string, queues map[string]string) error {
+	c.processed = 0
+	manifest, err := verifyBackup(archive)
+	if err != nil {
+		return err
+	}
+
+	targets := map[string]string{}
+	sources := map[string]string{}
+	definitions := map[string]*QueueDefinition{}
+	for _, q := range manifest.Queues {
+		target, selected := queues[q.Name]
+		if len(queues) == 0 || selected {
+			if target == "" {
+				target = q.Name
+			}
+			if source, ok := sources[target]; ok {
+				return fmt.Errorf("Queues %q and %q are both restored into %q", source, q.Name, target)
+			}
+			sources[target] = q.Name
+			targets[q.File] = target
+			definitions[target] = q.Definition
+		}
+	}
+	for name := range queues {
+		found := false
+		for _, q := range manifest.Queues {
+			found = found || q.Name == name
+		}
+		if !found {
+			return fmt.Errorf("Queue %q not found in the archive", name)
+		}
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("Failed to open a channel: %v", err)
+	}
+	defer ch.Close()
+
+	for target, def := range definitions {
+		if def == nil {
+			_, err = ch.QueueDeclarePassive(target, false, false, false, false, nil)
+			if err != nil {
+				return fmt.Errorf("Failed to inspect the queue %q: %v", target, err)
+			}
+			continue
+		}
+		_, err = ch.QueueDeclare(target, def.Durable, def.AutoDelete, false, false, def.Arguments)
+		if err != nil {
+			return fmt.Errorf("Failed to declare the queue %q: %v", target, err)
+		}
+	}
+
+	confirms, returns, err := confirmPublish(ch)
+	if err != nil {
+		return err
+	}
+	publish := func(exchange, key string, msg amqp.Publishing) error {
+		err := ch.Publish(exchange, key, true, false, msg)
+		if err != nil {
+			return fmt.Errorf("Error on message publishing: %v", err)
+		}
+		_, err = c.waitConfirm(ctx, confirms, returns)
+		return err
+	}
+
+	tr, _, closeArchive, err := openBackup(archive)
+	if err != nil {
+		return err
+	}
+	defer closeArchive()
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid archive: %v", err)
+		}
+		target, ok := targets[hdr.Name]
+		if !ok {
+			continue
+		}
+		stopped, err := c.publishMessages(ctx, publish, &jsonlReader{r: bufio.NewReader(tr)}, func(importedMessage) (string, string) {
+			return "", target
+		})
+		if err != nil || stopped {
+			return err
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandBackupRestore(t *testing.T) {
+	deliveries := []amqp.Delivery{
+		{DeliveryTag: 1, RoutingKey: "order.created", MessageId: "o-1", ContentType: "application/json",
+			Headers: amqp.Table{"x-tenant": "acme"}, Body: []byte(`{"id":1}`)},
+		{DeliveryTag: 2, RoutingKey: "order.note", MessageId: "o-2", Body: []byte("note")},
+	}
+
+	t.Run("Backup without removing the messages", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		archive := filepath.Join(dir, "backup.tar.gz")
+		tconn := testConnection{deliveries: deliveries}
+		// a consuming option can't remove the messages
+		amcmd := newTestCommand(&tconn, WithAutoACK(true), WithCount(1))
+		assert.NoError(t, amcmd.CommandBackup(archive, "orders", "notes"))
+		assert.Equal(t, 4, amcmd.Processed())
+		assert.Equal(t, 0, tconn.ackCount)
+		assert.Equal(t, 2, tconn.multipleNackCount)
+		assert.Equal(t, []string{"manifest.json", "queues/0001.jsonl", "queues/0002.jsonl"}, archiveEntries(archive))
+
+		infos, err := ioutil.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Len(t, infos, 1, "temporary files removed")
+
+		manifest, err := verifyBackup(archive)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, manifest.Version)
+		assert.Len(t, manifest.Queues, 2)
+		assert.Equal(t, "orders", manifest.Queues[0].Name)
+		assert.Equal(t, "queues/0001.jsonl", manifest.Queues[0].File)
+		assert.Equal(t, 2, manifest.Queues[0].Messages)
+		assert.Len(t, manifest.Queues[0].SHA256, 64)
+		assert.Equal(t, "notes", manifest.Queues[1].Name)
+	})
+
+	t.Run("Backup only the matching messages", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		archive := filepath.Join(dir, "backup.tar.gz")
+		f, err := ParseFilter("routing_key=order.note")
+		assert.NoError(t, err)
+		amcmd := newTestCommand(&testConnection{deliveries: deliveries}, WithFilters(f))
+		assert.NoError(t, amcmd.CommandBackup(archive, "orders", "notes"))
+		manifest, err := verifyBackup(archive)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, manifest.Queues[0].Messages)
+	})
+
+	t.Run("Restore into the same and renamed queues", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		archive := filepath.Join(dir, "backup.tar.gz")
+		assert.NoError(t, newTestCommand(&testConnection{deliveries: deliveries}).CommandBackup(archive, "orders", "notes"))
+
+		tconn := testConnection{}
+		amcmd := newTestCommand(&tconn)
+		assert.NoError(t, amcmd.CommandRestore(archive, nil))
+		assert.Equal(t, 4, amcmd.Processed())
+		assert.Equal(t, []string{"/orders", "/orders", "/notes", "/notes"}, tconn.routes)
+		assert.Equal(t, amqp.Table{"x-tenant": "acme"}, tconn.published[0].Headers)
+		assert.Equal(t, "o-1", tconn.published[0].MessageId)
+		assert.Equal(t, []byte("note"), tconn.published[1].Body)
+
+		tconn = testConnection{}
+		assert.NoError(t, amcmd.CommandRestore(archive, map[string]string{"notes": "notes-restored"}))
+		assert.Equal(t, 2, amcmd.Processed())
+		assert.Equal(t, []string{"/notes-restored", "/notes-restored"}, tconn.routes)
+		assert.Empty(t, tconn.declared)
+	})
+
+	t.Run("Backup and restore the queue definitions", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		archive := filepath.Join(dir, "backup.tar.gz")
+		server := newManagementServer(map[string]string{
+			"orders": `{"durable":true,"auto_delete":false,"arguments":{"x-message-ttl":60000,"x-dead-letter-exchange":"dlx"}}`,
+			"notes":  `{"durable":false,"auto_delete":true,"arguments":{}}`,
+		})
+		defer server.Close()
+		amcmd := newTestCommand(&testConnection{deliveries: deliveries}, WithManagementURL(server.URL))
+		assert.NoError(t, amcmd.CommandBackup(archive, "orders", "notes"))
+
+		orders := QueueDefinition{Durable: true, Arguments: amqp.Table{"x-message-ttl": int64(60000), "x-dead-letter-exchange": "dlx"}}
+		manifest, err := verifyBackup(archive)
+		assert.NoError(t, err)
+		assert.Equal(t, &orders, manifest.Queues[0].Definition)
+		assert.Equal(t, &QueueDefinition{AutoDelete: true}, manifest.Queues[1].Definition)
+
+		tconn := testConnection{}
+		assert.NoError(t, newTestCommand(&tconn).CommandRestore(archive, map[string]string{"orders": "orders-restored", "notes": ""}))
+		assert.Equal(t, map[string]QueueDefinition{"orders-restored": orders, "notes": {AutoDelete: true}}, tconn.declared)
+		assert.Len(t, tconn.published, 4)
+
+		assert.Error(t, newTestCommand(&testConnection{deliveries: deliveries}, WithManagementURL(server.URL)).
+			CommandBackup(filepath.Join(dir, "missing.tar.gz"), "orders", "missing"))
+		assert.Error(t, newTestCommand(&testConnection{errorChannelDeclare: true}).CommandRestore(archive, nil))
+	})
+
+	t.Run("Error restoring", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		archive := filepath.Join(dir, "backup.tar.gz")
+		assert.NoError(t, newTestCommand(&testConnection{deliveries: deliveries}).CommandBackup(archive, "orders", "notes"))
+
+		assert.Error(t, newTestCommand(&testConnection{}).CommandRestore(archive, map[string]string{"missing": ""}))
+		assert.Error(t, newTestCommand(&testConnection{errorChannelQueue: true}).CommandRestore(archive, nil))
+		assert.Error(t, newTestCommand(&testConnection{errorChannelPublish: true}).CommandRestore(archive, nil))
+		assert.Error(t, newTestCommand(&testConnection{errorChannelConfirm: true}).CommandRestore(archive, nil))
+		assert.Error(t, newTestCommand(&testConnection{unroutable: true}).CommandRestore(archive, nil))
+
+		// the restore stops at the first message not confirmed
+		tconn := testConnection{nackPublish: true}
+		assert.Error(t, newTestCommand(&tconn).CommandRestore(archive, nil))
+		assert.Len(t, tconn.published, 1)
+
+		assert.Error(t, newTestCommand(&testConnection{}).CommandRestore(filepath.Join(dir, "missing.tar.gz"), nil))
+
+		// two queues restored into the same one
+		assert.Error(t, newTestCommand(&testConnection{}).CommandRestore(archive, map[string]string{"orders": "x", "notes": "x"}))
+		assert.Error(t, newTestCommand(&testConnection{}).CommandRestore(archive, map[string]string{"orders": "", "notes": "orders"}))
+
+		// the checksum of the queue file doesn't match
+		manifest, err := verifyBackup(archive)
+		assert.NoError(t, err)
+		manifest.Queues[1].SHA256 = manifest.Queues[0].SHA256
+		corrupted := filepath.Join(dir, "corrupted.tar.gz")
+		assert.NoError(t, writeBackupWith(corrupted, manifest, `{"body":"x"}`+"\n"))
+		tconn = testConnection{}
+		assert.Error(t, newTestCommand(&tconn).CommandRestore(corrupted, nil))
+		assert.Empty(t, tconn.published)
+
+		// not a gzip archive
+		invalid := filepath.Join(dir, "invalid.tar.gz")
+		assert.NoError(t, ioutil.WriteFile(invalid, []byte("not an archive"), 0644))
+		assert.Error(t, newTestCommand(&testConnection{}).CommandRestore(invalid, nil))
+	})
+
+	t.Run("Error backing up", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		archive := filepath.Join(dir, "backup.tar.gz")
+		amcmd := newTestCommand(&testConnection{errorChannelQueue: true})
+		assert.Error(t, amcmd.CommandBackup(archive, "orders"))
+		assert.Error(t, amcmd.CommandBackup(archive))
+		_, err := os.Stat(archive)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+// writeBackupWith writes an archive with the manifest and the same
+// content for every queue file
+func writeBackupWith(archive string, manifest BackupManifest, content string) error {
+	tmp := testTempDir()
+	defer os.RemoveAll(tmp)
+	for i, q := range manifest.Queues {
+		if err := ioutil.WriteFile(filepath.Join(tmp, filepath.Base(q.File)), []byte(content), 0644); err != nil {
+			return err
+		}
+		manifest.Queues[i].Bytes = int64(len(content))
+	}
+	return writeBackup(archive, tmp, manifest)
+}
+
+// archiveEntries returns the names of the entries of a tar.gz archive
+func archiveEntries(archive string) []string {
+	f, err := os.Open(archive)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for hdr, err := tr.Next(); err == nil; hdr, err = tr.Next() {
+		names = append(names, hdr.Name)
+	}
+	return names
+}
@@ -0,0 +1,767 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/streadway/amqp"
+	"io"
+	"sync"
+	"time"
+)
+
+// CommandInfo defines a basic structure to execute amqp commands
+type CommandInfo struct {
+	connection        ConnectionSettings
+	dstConnection     *ConnectionSettings
+	autoACK           bool
+	prefetch          int
+	count             int
+	untilEmpty        bool
+	idleTimeout       time.Duration
+	file              string
+	format            string
+	formatPrefix      string
+	formatSeparator   string
+	formatPostfix     string
+	template          string
+	columns           []string
+	compression       string
+	splitEvery        int
+	splitSize         int64
+	splitInterval     time.Duration
+	splitTimestamp    bool
+	dir               string
+	fileName          string
+	toExchange        bool
+	routingKey        string
+	routingKeyHeader  string
+	dialer            Dialer
+	dstDialer         Dialer
+	reconnectAttempts int
+	reconnectDelay    time.Duration
+	snapshot          bool
+	filters           []Filter
+	maxHeld           int
+	deathReasons      []string
+	maxDeaths         int
+	stripDeaths       bool
+	redriveToQueue    bool
+	headerRules       []headerRule
+	properties        []property
+	provenance        bool
+	repeat            int
+	rate              float64
+	managementURL     string
+
+	processed     int
+	interruptInit sync.Once
+	interruptOnce sync.Once
+	interrupt     chan struct{}
+}
+
+const toolName = "amqp-go-tool"
+
+// maxPrefetch is the biggest prefetch count of the protocol
+const maxPrefetch = 65535
+
+// DefaultMaxHeld is the default limit of the messages not matching the
+// filters held unacked by a command (see WithMaxHeld)
+const DefaultMaxHeld = 10000
+
+// AmqpCommand general interface for the export and the copy or move
+// of messages. The Context variants stop the command when the context
+// is done, returning a *CanceledError. The other commands are methods
+// of CommandInfo.
+type AmqpCommand interface {
+	CommandExport(queue string) error
+	CommandExportContext(ctx context.Context, queue string) error
+	CommandCopyMoveToQueue(srcQueue, dstQueue string) error
+	CommandCopyMoveToQueueContext(ctx context.Context, srcQueue, dstQueue string) error
+	Interrupt()
+	Processed() int
+}
+
+var _ AmqpCommand = (*CommandInfo)(nil)
+
+// ErrInterrupted is the error of the *CanceledError returned when the
+// command is interrupted (see Interrupt) while waiting for the broker
+// to confirm a message
+var ErrInterrupted = errors.New("Interrupted")
+
+// CanceledError is returned when the context of a command is
+// cancelled or its deadline exceeded, or when it is interrupted while
+// waiting for a publish confirmation. Err is the context error or
+// ErrInterrupted, also returned by Unwrap (errors.Is(err,
+// context.Canceled) works).
+type CanceledError struct {
+	// Processed is the number of messages processed before the
+	// cancellation
+	Processed int
+	Err       error
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("Command cancelled after %d messages: %v", e.Processed, e.Err)
+}
+
+// Unwrap returns the context error
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// NewCommandInfo creates a new instance that can execute the Amqp
+// commands, configured with the options. New commands are added as
+// methods of CommandInfo, without changing the AmqpCommand
+// interface. Without a dialer option, the default amqp dialer is used
+// with the TLS options of the connection.
+func NewCommandInfo(opts ...Option) *CommandInfo {
+	ci := CommandInfo{
+		connection: ConnectionSettings{
+			Host:     "localhost",
+			Port:     5672,
+			Username: "guest",
+			Password: "guest",
+			Vhost:    "/",
+		},
+		prefetch:        1,
+		format:          FormatRaw,
+		formatSeparator: "\n",
+		maxHeld:         DefaultMaxHeld,
+	}
+	for _, opt := range opts {
+		opt(&ci)
+	}
+	if ci.dialer == nil {
+		ci.dialer = NewDialer(ci.connection.TLS)
+	}
+	if ci.dstConnection != nil && ci.dstDialer == nil {
+		ci.dstDialer = NewDialer(ci.dstConnection.TLS)
+	}
+	return &ci
+}
+
+// dial opens a new connection with the broker using the command
+// connection settings
+func (c *CommandInfo) dial(ctx context.Context) (Connection, error) {
+	url, err := c.connection.url()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.dialer(ctx, url)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, c.canceled(ctx)
+		}
+		return nil, fmt.Errorf("Failed to connect to RabbitMQ: %v", err)
+	}
+	return conn, nil
+}
+
+// canceled builds the error returned when the context is done
+func (c *CommandInfo) canceled(ctx context.Context) error {
+	return &CanceledError{Processed: c.processed, Err: ctx.Err()}
+}
+
+// Interrupt stops the running command gracefully: the consumption is
+// cancelled, the in-flight deliveries are requeued and the output is
+// finished and closed.
+func (c *CommandInfo) Interrupt() {
+	c.interruptOnce.Do(func() {
+		close(c.interrupted())
+	})
+}
+
+// Processed returns the number of messages processed by the last
+// command execution.
+func (c *CommandInfo) Processed() int {
+	return c.processed
+}
+
+// interrupted returns the channel closed on interruption
+func (c *CommandInfo) interrupted() chan struct{} {
+	c.interruptInit.Do(func() {
+		c.interrupt = make(chan struct{})
+	})
+	return c.interrupt
+}
+
+// CommandExport exports the content of a queue using the queue
+// configuration and predefined format.
+func (c *CommandInfo) CommandExport(queue string) error {
+	return c.CommandExportContext(context.Background(), queue)
+}
+
+// CommandExportContext exports the content of a queue until the
+// context is done.
+func (c *CommandInfo) CommandExportContext(ctx context.Context, queue string) (err error) {
+	c.processed = 0
+	src := c.source()
+	err = c.open(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer src.close()
+
+	w, closeOutput, err := c.openOutput()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := closeOutput(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	_, err = c.consume(ctx, src, queue, nil, func(msg amqp.Delivery) error {
+		err := w.write(msg)
+		if err != nil {
+			return err
+		}
+		if c.autoACK {
+			msg.Ack(false)
+		}
+		return nil
+	})
+	return err
+}
+
+// CommandCopyMoveToQueue copy or moves messages from one queue to another
+// one (or to an exchange, see WithExchange), in the same broker or in
+// another one (see WithDestination). The copy is a exact one: it
+// propagate the meta-information of the message, not just the
+// content. When moving, the destiny channel works in confirm mode and
+// the source message is only acked after the broker confirms the
+// publish (it is requeued if rejected or unroutable).
+func (c *CommandInfo) CommandCopyMoveToQueue(srcQueue, dstQueue string) error {
+	return c.CommandCopyMoveToQueueContext(context.Background(), srcQueue, dstQueue)
+}
+
+// CommandCopyMoveToQueueContext copy or moves messages from one queue
+// to another one until the context is done.
+func (c *CommandInfo) CommandCopyMoveToQueueContext(ctx context.Context, srcQueue, dstQueue string) error {
+	return c.shovel(ctx, srcQueue, nil, func(msg amqp.Delivery) (string, string, amqp.Table) {
+		exchange, key := c.route(dstQueue, msg.RoutingKey, msg.Headers)
+		return exchange, key, msg.Headers
+	})
+}
+
+// shovel publishes the messages of the source queue accepted (all if
+// accept is nil) to the exchange and routing key, and with the
+// headers, of the target, rewritten with the header rules and the
+// property overrides, removing them from the source queue when autoACK
+// is enabled
+func (c *CommandInfo) shovel(ctx context.Context, srcQueue string, accept func(amqp.Delivery) bool,
+	target func(amqp.Delivery) (string, string, amqp.Table)) (err error) {
+	c.processed = 0
+	rewrite, err := c.rewriter(srcQueue)
+	if err != nil {
+		return err
+	}
+	src := c.source()
+	err = c.open(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer src.close()
+
+	// moved messages are only acked once the broker confirms the
+	// publish, and they are published as mandatory so the broker
+	// returns them (before the confirmation) when they are unroutable
+	var confirms chan amqp.Confirmation
+	var returns chan amqp.Return
+	dst := c.destination()
+	dst.setup = func(ch Channel) error {
+		if !c.autoACK {
+			return nil
+		}
+		var err error
+		confirms, returns, err = confirmPublish(ch)
+		return err
+	}
+	err = c.open(ctx, dst)
+	if err != nil {
+		return err
+	}
+	defer dst.close()
+
+	// publish sends a message to the destiny, waiting for the
+	// confirmation when moving. It reports when the failure is caused
+	// by a lost connection, so the message can be published again.
+	publish := func(exchange, key string, msg amqp.Publishing) (bool, error) {
+		err := dst.ch.Publish(exchange, key, c.autoACK, false, msg)
+		if err != nil {
+			return true, fmt.Errorf("Error on message publishing: %v", err)
+		}
+		if !c.autoACK {
+			return false, nil
+		}
+		return c.waitConfirm(ctx, confirms, returns)
+	}
+
+	w, closeOutput, err := c.openOutput()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := closeOutput(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	_, err = c.consume(ctx, src, srcQueue, accept, func(msg amqp.Delivery) error {
+		exchange, key, headers := target(msg)
+		amqpMsg := amqp.Publishing{
+			Headers:         headers,
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			DeliveryMode:    msg.DeliveryMode,
+			Priority:        msg.Priority,
+			CorrelationId:   msg.CorrelationId,
+			ReplyTo:         msg.ReplyTo,
+			Expiration:      msg.Expiration,
+			MessageId:       msg.MessageId,
+			Timestamp:       msg.Timestamp,
+			Type:            msg.Type,
+			UserId:          msg.UserId,
+			AppId:           msg.AppId,
+			Body:            msg.Body,
+		}
+		rewrite(&amqpMsg, msg)
+		for {
+			lost, err := publish(exchange, key, amqpMsg)
+			if err == nil {
+				dst.progress()
+				break
+			}
+			if lost {
+				err = c.reconnect(ctx, dst, err)
+				if err == nil {
+					continue
+				}
+			}
+			if c.autoACK {
+				msg.Nack(false, true)
+			}
+			return err
+		}
+		err := w.write(msg)
+		if err != nil {
+			return err
+		}
+		if c.autoACK {
+			err = msg.Ack(false)
+			if err != nil {
+				return fmt.Errorf("Error acknowledging the moved message: %v", err)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// confirmPublish enables the publisher confirms on the channel,
+// returning the channels of the confirmations and of the messages
+// returned by the broker (published as mandatory)
+func confirmPublish(ch Channel) (chan amqp.Confirmation, chan amqp.Return, error) {
+	err := ch.Confirm(false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to enable publisher confirms: %v", err)
+	}
+	return ch.NotifyPublish(make(chan amqp.Confirmation, 1)), ch.NotifyReturn(make(chan amqp.Return, 1)), nil
+}
+
+// waitConfirm waits for the confirmation of the last published message,
+// failing when it is rejected or returned as unroutable, or when the
+// command is interrupted or the context done meanwhile. It reports
+// when the channel was closed before the confirmation.
+func (c *CommandInfo) waitConfirm(ctx context.Context, confirms chan amqp.Confirmation, returns chan amqp.Return) (bool, error) {
+	select {
+	case confirm, ok := <-confirms:
+		if !ok {
+			return true, fmt.Errorf("Destiny channel closed before the publish confirmation")
+		}
+		if !confirm.Ack {
+			return false, fmt.Errorf("Message publishing rejected by the broker")
+		}
+	case <-ctx.Done():
+		return false, c.canceled(ctx)
+	case <-c.interrupted():
+		return false, &CanceledError{Processed: c.processed, Err: ErrInterrupted}
+	}
+	select {
+	case ret := <-returns:
+		return false, fmt.Errorf("Message returned by the broker, not routed to %q with key %q: %s", ret.Exchange, ret.RoutingKey, ret.ReplyText)
+	default:
+	}
+	return false, nil
+}
+
+// consume registers a consumer in the queue of the source and
+// processes every delivery with the handler, until the count of
+// messages is reached. In until empty mode the depth of the queue is
+// taken at start and the consumption also stops once those messages
+// are received, and with an idle timeout it stops when no message
+// arrives in time. On interruption or when the context is done, the
+// consumer is cancelled and the deliveries not yet processed are
+// requeued. When the source is lost and the processed messages are
+// acked, it is reconnected to continue (without acks, the redelivered
+// messages would be processed again); otherwise it fails, as the count
+// or the depth was not reached. It returns the number of processed
+// messages.
+//
+// The messages not matching the filters, or not accepted (if accept is
+// not nil), are not processed: they are held unacked and requeued at
+// the end, so they are not received again meanwhile. When the held
+// deliveries (and the processed ones, without acks) fill the prefetch,
+// the consumer is registered again with a bigger one to keep receiving
+// messages. Once the maximum of held messages (see WithMaxHeld) or the
+// protocol limit of the prefetch is reached, the held deliveries are
+// requeued and it fails.
+//
+// In snapshot mode (see WithSnapshot, implied by until empty without
+// acks) the depth of the queue also bounds the consumption, every
+// message is held unacked (the prefetch is the depth) and all of them
+// are requeued at the end, so the queue keeps the same messages in the
+// same order.
+func (c *CommandInfo) consume(ctx context.Context, src *endpoint, queue string, accept func(amqp.Delivery) bool, handle func(amqp.Delivery) error) (int, error) {
+	snapshot := (c.snapshot || c.untilEmpty) && !c.autoACK
+	depth := 0
+	if c.untilEmpty || snapshot {
+		q, err := src.ch.QueueDeclarePassive(queue, false, false, false, false, nil)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to inspect the queue: %v", err)
+		}
+		if q.Messages == 0 {
+			return 0, nil
+		}
+		depth = q.Messages
+	}
+
+	prefetch := c.prefetch
+	if snapshot {
+		prefetch = depth
+		if c.count > 0 && c.count < depth && len(c.filters) == 0 {
+			prefetch = c.count
+		}
+		if prefetch > maxPrefetch {
+			prefetch = 0
+		}
+	}
+
+	// the consumer is registered again when the source is reopened, and
+	// with a bigger prefetch (limit) when the deliveries held unacked
+	// leave no room to receive more
+	var msgs <-chan amqp.Delivery
+	limit := prefetch
+	src.setup = func(ch Channel) error {
+		var err error
+		limit = prefetch
+		msgs, err = c.subscribe(ch, queue, limit)
+		return err
+	}
+	err := src.setup(src.ch)
+	if err != nil {
+		return 0, err
+	}
+
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if c.idleTimeout > 0 {
+		timer = time.NewTimer(c.idleTimeout)
+		defer timer.Stop()
+		idle = timer.C
+	}
+
+	// last delivery held unacked (by the snapshot or not matching the
+	// filters), to requeue it and all the previous ones at the end
+	var held *amqp.Delivery
+	unacked := 0
+	skipped := 0
+	received := 0
+
+	interrupted := c.interrupted()
+	for (c.count == 0 || c.processed < c.count) && (depth == 0 || received < depth) {
+		select {
+		case <-interrupted:
+			return c.processed, c.cancelConsumer(src.ch, msgs, held)
+		case <-ctx.Done():
+			return c.processed, c.cancelConsumerContext(ctx, src.ch, msgs, held)
+		default:
+		}
+
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				if !c.autoACK || c.reconnectAttempts <= 0 {
+					// the count or the depth was not reached
+					return c.processed, fmt.Errorf("Source channel closed after %d messages", c.processed)
+				}
+				err = c.reconnect(ctx, src, fmt.Errorf("Source channel closed"))
+				if err != nil {
+					return c.processed, err
+				}
+				// the held deliveries were requeued with the channel
+				held, unacked, skipped = nil, 0, 0
+				continue
+			}
+			src.progress()
+			received++
+			if !matchAll(c.filters, msg) || (accept != nil && !accept(msg)) {
+				held = &msg
+				unacked++
+				skipped++
+				if !snapshot && skipped >= c.maxHeld {
+					err = c.cancelConsumer(src.ch, msgs, held)
+					if err != nil {
+						return c.processed, err
+					}
+					return c.processed, fmt.Errorf("Stopped after %d messages: %d messages not matching the filters were held, the limit (they are requeued)", c.processed, skipped)
+				}
+			} else {
+				err = handle(msg)
+				if err != nil {
+					return c.processed, err
+				}
+				c.processed++
+				if snapshot {
+					held = &msg
+				}
+				if !c.autoACK {
+					unacked++
+				}
+			}
+			if !snapshot && limit > 0 && unacked >= limit {
+				if limit >= maxPrefetch {
+					err = c.cancelConsumer(src.ch, msgs, held)
+					if err != nil {
+						return c.processed, err
+					}
+					return c.processed, fmt.Errorf("Stopped after %d messages: %d messages were held unacked, the prefetch limit (they are requeued)", c.processed, unacked)
+				}
+				limit = raisePrefetch(limit, unacked)
+				var requeued int
+				msgs, requeued, err = c.resubscribe(src.ch, msgs, queue, limit)
+				if err != nil {
+					return c.processed, err
+				}
+				received -= requeued
+			}
+		case <-idle:
+			if held != nil {
+				return c.processed, c.cancelConsumer(src.ch, msgs, held)
+			}
+			return c.processed, nil
+		case <-interrupted:
+			return c.processed, c.cancelConsumer(src.ch, msgs, held)
+		case <-ctx.Done():
+			return c.processed, c.cancelConsumerContext(ctx, src.ch, msgs, held)
+		}
+
+		if timer != nil {
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(c.idleTimeout)
+		}
+	}
+	if held != nil {
+		return c.processed, c.cancelConsumer(src.ch, msgs, held)
+	}
+	return c.processed, nil
+}
+
+// subscribe registers the consumer in the queue with the prefetch
+func (c *CommandInfo) subscribe(ch Channel, queue string, prefetch int) (<-chan amqp.Delivery, error) {
+	err := ch.Qos(prefetch, 0, false) // prefetch count
+	if err != nil {
+		return nil, fmt.Errorf("Error defining prefetch: %v", err)
+	}
+
+	msgs, err := ch.Consume(queue, toolName, false, false, false, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to register a consumer: %v", err)
+	}
+	return msgs, nil
+}
+
+// raisePrefetch doubles the prefetch until it leaves room over the
+// unacked deliveries, up to the protocol limit
+func raisePrefetch(prefetch, unacked int) int {
+	for prefetch <= unacked && prefetch < maxPrefetch {
+		prefetch *= 2
+	}
+	if prefetch > maxPrefetch {
+		return maxPrefetch
+	}
+	return prefetch
+}
+
+// resubscribe registers the consumer again with the prefetch, as the
+// prefetch only applies to the consumers registered after it. The
+// deliveries in flight to the previous consumer are requeued (and
+// counted) and the held ones are kept unacked.
+func (c *CommandInfo) resubscribe(ch Channel, msgs <-chan amqp.Delivery, queue string, prefetch int) (<-chan amqp.Delivery, int, error) {
+	err := ch.Cancel(toolName, false)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to cancel the consumer: %v", err)
+	}
+	requeued := 0
+	for msg := range msgs {
+		err = msg.Nack(false, true)
+		if err != nil {
+			return nil, requeued, fmt.Errorf("Error requeuing the message: %v", err)
+		}
+		requeued++
+	}
+	msgs, err = c.subscribe(ch, queue, prefetch)
+	return msgs, requeued, err
+}
+
+// cancelConsumer stops the consumer and requeues the deliveries
+// received but not processed yet, after the held delivery and all the
+// previous ones (if any)
+func (c *CommandInfo) cancelConsumer(ch Channel, msgs <-chan amqp.Delivery, held *amqp.Delivery) error {
+	err := ch.Cancel(toolName, false)
+	if err != nil {
+		return fmt.Errorf("Failed to cancel the consumer: %v", err)
+	}
+	if held != nil {
+		err = held.Nack(true, true)
+		if err != nil {
+			return fmt.Errorf("Error requeuing the copied messages: %v", err)
+		}
+	}
+	for msg := range msgs {
+		err = msg.Nack(false, true)
+		if err != nil {
+			return fmt.Errorf("Error requeuing the message: %v", err)
+		}
+	}
+	return nil
+}
+
+// cancelConsumerContext stops the consumer when the context is done,
+// returning the cancellation error
+func (c *CommandInfo) cancelConsumerContext(ctx context.Context, ch Channel, msgs <-chan amqp.Delivery, held *amqp.Delivery) error {
+	err := c.cancelConsumer(ch, msgs, held)
+	if err != nil {
+		return err
+	}
+	return c.canceled(ctx)
+}
+
+// route resolves the exchange and routing key to publish a message to
+// the destination: the queue through the default exchange, or the
+// destination exchange with the key of the routing key header, the
+// fixed routing key or the original one, in that order
+func (c *CommandInfo) route(destination, routingKey string, headers amqp.Table) (string, string) {
+	if !c.toExchange {
+		return "", destination
+	}
+	if c.routingKeyHeader != "" {
+		switch v := headers[c.routingKeyHeader].(type) {
+		case nil:
+		case string:
+			return destination, v
+		case []byte:
+			return destination, string(v)
+		default:
+			return destination, fmt.Sprint(v)
+		}
+	}
+	if c.routingKey != "" {
+		return destination, c.routingKey
+	}
+	return destination, routingKey
+}
+
+// CommandImport publishes the messages of an exported file (jsonl
+// envelopes or raw bodies) to a queue, or to an exchange (see
+// WithExchange). The properties and headers of the envelopes are
+// restored.
+func (c *CommandInfo) CommandImport(file, destination string) error {
+	return c.CommandImportContext(context.Background(), file, destination)
+}
+
+// CommandImportContext publishes the messages of an exported file
+// until the context is done.
+func (c *CommandInfo) CommandImportContext(ctx context.Context, file, destination string) error {
+	c.processed = 0
+	r, closeInput, err := c.openInput(file)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("Failed to open a channel: %v", err)
+	}
+	defer ch.Close()
+
+	publish := func(exchange, key string, msg amqp.Publishing) error {
+		err := ch.Publish(exchange, key, false, false, msg)
+		if err != nil {
+			return fmt.Errorf("Error on message publishing: %v", err)
+		}
+		return nil
+	}
+	_, err = c.publishMessages(ctx, publish, r, func(im importedMessage) (string, string) {
+		return c.route(destination, im.routingKey, im.msg.Headers)
+	})
+	return err
+}
+
+// publishMessages publishes the messages of the reader to the
+// exchange and routing key of the route with the publish function,
+// until the count is reached. It reports if the command was
+// interrupted.
+func (c *CommandInfo) publishMessages(ctx context.Context, publish func(exchange, key string, msg amqp.Publishing) error,
+	r messageReader, route func(importedMessage) (string, string)) (bool, error) {
+	interrupted := c.interrupted()
+	for c.count == 0 || c.processed < c.count {
+		select {
+		case <-interrupted:
+			return true, nil
+		case <-ctx.Done():
+			return true, c.canceled(ctx)
+		default:
+		}
+
+		im, err := r.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+
+		exchange, key := route(im)
+		err = publish(exchange, key, im.msg)
+		if err != nil {
+			return false, err
+		}
+		c.processed++
+	}
+	return false, nil
+}
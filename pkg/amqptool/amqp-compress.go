@@ -0,0 +1,104 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressions of the output files (see WithCompression)
+const (
+	CompressNone = "none"
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// outputCompression returns the compression of the output: the
+// configured one or, if none, the one of the file extension (.gz,
+// .zst or .zstd)
+func (c *CommandInfo) outputCompression() (string, error) {
+	switch c.compression {
+	case "":
+		switch {
+		case strings.HasSuffix(c.file, ".gz"):
+			return CompressGzip, nil
+		case strings.HasSuffix(c.file, ".zst"), strings.HasSuffix(c.file, ".zstd"):
+			return CompressZstd, nil
+		}
+		return CompressNone, nil
+	case CompressNone, CompressGzip, CompressZstd:
+		return c.compression, nil
+	}
+	return "", fmt.Errorf("Unknown compression %q", c.compression)
+}
+
+// nopWriteCloser is the compressor of the uncompressed output
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// compressWriter returns the writer compressing the output. Closing it
+// flushes the compressed data, but it doesn't close the output.
+func compressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressGzip:
+		return gzip.NewWriter(w), nil
+	case CompressZstd:
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create the zstd compressor: %v", err)
+		}
+		return zw, nil
+	}
+	return nopWriteCloser{w}, nil
+}
+
+// decompressReader returns the reader of the input, decompressed when
+// it starts with the gzip or zstd magic bytes, and the function to
+// release the decompressor
+func decompressReader(r io.Reader) (io.Reader, func(), error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to read the gzip input: %v", err)
+		}
+		return zr, func() { zr.Close() }, nil
+	case bytes.HasPrefix(head, zstdMagic):
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to read the zstd input: %v", err)
+		}
+		return zr, zr.Close, nil
+	}
+	return br, func() {}, nil
+}
@@ -0,0 +1,114 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputCompression(t *testing.T) {
+	tests := []struct {
+		file        string
+		compression string
+		result      string
+	}{
+		{"", "", CompressNone},
+		{"messages.jsonl", "", CompressNone},
+		{"messages.jsonl.gz", "", CompressGzip},
+		{"messages.jsonl.zst", "", CompressZstd},
+		{"messages.zstd", "", CompressZstd},
+		{"messages.jsonl.gz", CompressNone, CompressNone},
+		{"messages.jsonl", CompressZstd, CompressZstd},
+		{"", CompressGzip, CompressGzip},
+	}
+	for _, tt := range tests {
+		c := CommandInfo{file: tt.file, compression: tt.compression}
+		compression, err := c.outputCompression()
+		assert.NoError(t, err)
+		assert.Equal(t, tt.result, compression, tt.file)
+	}
+
+	c := CommandInfo{compression: "lz4"}
+	_, err := c.outputCompression()
+	assert.Error(t, err)
+}
+
+func TestCompressWriter(t *testing.T) {
+	content := bytes.Repeat([]byte("message body\n"), 1000)
+	for _, compression := range []string{CompressNone, CompressGzip, CompressZstd} {
+		t.Run(compression, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := compressWriter(&buf, compression)
+			assert.NoError(t, err)
+			_, err = w.Write(content)
+			assert.NoError(t, err)
+			assert.NoError(t, w.Close())
+			if compression != CompressNone {
+				assert.True(t, buf.Len() < len(content))
+			}
+
+			r, closeReader, err := decompressReader(&buf)
+			assert.NoError(t, err)
+			defer closeReader()
+			result, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, content, result)
+		})
+	}
+
+	t.Run("Error with corrupted gzip", func(t *testing.T) {
+		_, _, err := decompressReader(bytes.NewReader([]byte{0x1f, 0x8b, 0, 0}))
+		assert.Error(t, err)
+	})
+}
+
+func TestCommandCompressed(t *testing.T) {
+	dir := testTempDir()
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"messages.jsonl.gz", "messages.jsonl.zst"} {
+		t.Run("Export and import "+name, func(t *testing.T) {
+			file := filepath.Join(dir, name)
+			export := newTestCommand(&testConnection{}, WithCount(5), WithFile(file), WithFormat(FormatJSONL))
+			assert.NoError(t, export.CommandExport("test"))
+
+			content, err := ioutil.ReadFile(file)
+			assert.NoError(t, err)
+			assert.NotContains(t, string(content), "routing_key")
+
+			tconn := testConnection{}
+			imp := newTestCommand(&tconn, WithFormat(FormatJSONL))
+			assert.NoError(t, imp.CommandImport(file, "test"))
+			assert.Equal(t, []string{"1", "2", "3", "4", "5"}, tconn.dataResult)
+		})
+	}
+
+	t.Run("Error with unknown compression", func(t *testing.T) {
+		file := filepath.Join(dir, "unknown")
+		export := newTestCommand(&testConnection{}, WithFile(file), WithCompression("lz4"))
+		assert.Error(t, export.CommandExport("test"))
+		assert.False(t, fileExists(file))
+	})
+}
+
+func fileExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
@@ -0,0 +1,172 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// connectionTimeout bounds the tcp connection and the protocol
+// handshake, the same as the default amqp dialer
+const connectionTimeout = 30 * time.Second
+
+// Default ports of the broker, without and with TLS
+const (
+	defaultPort    = 5672
+	defaultTLSPort = 5671
+)
+
+// ConnectionSettings defines how to reach the broker. A full AMQP URI
+// has preference over the individual host, port, credentials and
+// vhost values. Without a port (in the URI or the settings) the
+// default one is used, 5671 with TLS and 5672 otherwise.
+type ConnectionSettings struct {
+	URI      string
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Vhost    string
+	TLS      TLSOptions
+}
+
+// uri resolves the settings into a parsed AMQP URI, switching to the
+// amqps scheme (and port, if none is defined) when TLS is requested
+func (s ConnectionSettings) uri() (amqp.URI, error) {
+	var uri amqp.URI
+	defaultTo := defaultPort
+	if s.TLS.enabled() {
+		defaultTo = defaultTLSPort
+	}
+	if s.URI != "" {
+		var err error
+		uri, err = amqp.ParseURI(s.URI)
+		if err != nil {
+			return uri, fmt.Errorf("Invalid AMQP URI: %v", err)
+		}
+		// the parsed port is the default of the scheme when the uri
+		// has none, and TLS forced on an amqp uri changes it
+		if u, err := url.Parse(s.URI); err == nil && u.Port() == "" && uri.Scheme == "amqp" {
+			uri.Port = defaultTo
+		}
+	} else {
+		port := s.Port
+		if port == 0 {
+			port = defaultTo
+		}
+		uri = amqp.URI{
+			Scheme:   "amqp",
+			Host:     s.Host,
+			Port:     port,
+			Username: s.Username,
+			Password: s.Password,
+			Vhost:    s.Vhost,
+		}
+		if uri.Vhost == "" {
+			uri.Vhost = "/"
+		}
+	}
+
+	if s.TLS.enabled() {
+		uri.Scheme = "amqps"
+	}
+	return uri, nil
+}
+
+// url returns the escaped connection url for the settings
+func (s ConnectionSettings) url() (string, error) {
+	uri, err := s.uri()
+	if err != nil {
+		return "", err
+	}
+	return uri.String(), nil
+}
+
+// NewDialer creates the default dialer of the commands, using the TLS
+// options for amqps urls. The context bounds the tcp connection and
+// the TLS and AMQP handshakes, so a cancellation or deadline aborts a
+// connection attempt in progress.
+func NewDialer(tlsOptions TLSOptions) Dialer {
+	return func(ctx context.Context, url string) (Connection, error) {
+		config := amqp.Config{
+			Heartbeat: 10 * time.Second,
+			Locale:    "en_US",
+		}
+		if strings.HasPrefix(url, "amqps://") {
+			cfg, err := newTLSConfig(tlsOptions)
+			if err != nil {
+				return nil, err
+			}
+			config.TLSClientConfig = cfg
+		}
+
+		// the watcher aborts the handshake as soon as the context is
+		// done, and it is waited before returning the connection so it
+		// can't break the connection once established
+		handshake := make(chan struct{})
+		var watcher sync.WaitGroup
+		config.Dial = func(network, addr string) (net.Conn, error) {
+			d := net.Dialer{Timeout: connectionTimeout}
+			conn, err := d.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			deadline := time.Now().Add(connectionTimeout)
+			if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+				deadline = ctxDeadline
+			}
+			if err = conn.SetDeadline(deadline); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			watcher.Add(1)
+			go func() {
+				defer watcher.Done()
+				select {
+				case <-ctx.Done():
+					conn.SetDeadline(time.Unix(1, 0))
+				case <-handshake:
+				}
+			}()
+			return conn, nil
+		}
+
+		conn, err := amqp.DialConfig(url, config)
+		close(handshake)
+		watcher.Wait()
+		if ctx.Err() != nil {
+			if conn != nil {
+				conn.Close()
+			}
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			// the connection deadline can expire just before the
+			// context one is reported as done
+			if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+				return nil, context.DeadlineExceeded
+			}
+			return nil, err
+		}
+		return &wrapperConn{conn: conn}, nil
+	}
+}
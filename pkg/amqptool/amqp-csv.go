@@ -0,0 +1,74 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"github.com/streadway/amqp"
+)
+
+// DefaultColumns are the columns of the CSV format when none is
+// defined (see WithColumns)
+var DefaultColumns = []string{"message_id", "timestamp", "routing_key", "content_type", "body"}
+
+// csvWriter writes a header row with the columns and a row per
+// message, with an empty cell for the missing values. The columns are
+// fields of the filters (see Filter), resolved the same way.
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	if len(columns) == 0 {
+		columns = DefaultColumns
+	}
+	for _, column := range columns {
+		if !validField(column) {
+			return nil, fmt.Errorf("Unknown CSV column %q", column)
+		}
+	}
+	return &csvWriter{w: csv.NewWriter(w), columns: columns}, nil
+}
+
+func (c *csvWriter) begin() error {
+	c.w.Write(c.columns)
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) write(msg amqp.Delivery) error {
+	d := &deliveryFields{msg: msg}
+	record := make([]string, 0, len(c.columns))
+	for _, field := range c.columns {
+		v, ok := d.value(field)
+		if !ok {
+			v = nil
+		}
+		record = append(record, formatValue(v))
+	}
+	c.w.Write(record)
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return fmt.Errorf("Error writing message content in file: %v", err)
+	}
+	return nil
+}
+
+func (c *csvWriter) end() error {
+	return nil
+}
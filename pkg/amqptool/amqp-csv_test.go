@@ -0,0 +1,98 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVWriter(t *testing.T) {
+	msgs := []amqp.Delivery{
+		{
+			MessageId: "m-1",
+			Timestamp: time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC),
+			Priority:  5,
+			Headers:   amqp.Table{"x-tenant": "acme", "x-retries": int32(2)},
+			Body:      []byte(`{"orderId":"o-1","note":"a, \"b\"\nc","lines":[{"sku":"A1"}],"total":10.5}`),
+		},
+		{MessageId: "m-2", Body: []byte("plain text")},
+	}
+
+	var buf bytes.Buffer
+	w, err := newCSVWriter(&buf, []string{"message_id", "timestamp", "priority", "headers.x-tenant",
+		"headers.x-retries", "body.orderId", "body.note", "body.lines.0.sku", "body.total", "body.lines"})
+	assert.NoError(t, err)
+	assert.NoError(t, w.begin())
+	for _, msg := range msgs {
+		assert.NoError(t, w.write(msg))
+	}
+	assert.NoError(t, w.end())
+	assert.Equal(t, `message_id,timestamp,priority,headers.x-tenant,headers.x-retries,body.orderId,body.note,body.lines.0.sku,body.total,body.lines
+m-1,2024-03-01T10:30:00Z,5,acme,2,o-1,"a, ""b""
+c",A1,10.5,"[{""sku"":""A1""}]"
+m-2,,0,,,,,,,
+`, buf.String())
+
+	t.Run("Default columns", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := newCSVWriter(&buf, nil)
+		assert.NoError(t, err)
+		assert.NoError(t, w.begin())
+		assert.NoError(t, w.write(msgs[1]))
+		assert.Equal(t, "message_id,timestamp,routing_key,content_type,body\nm-2,,,,plain text\n", buf.String())
+	})
+
+	t.Run("Error with unknown columns", func(t *testing.T) {
+		for _, column := range []string{"", "unknown", "headers.", "body.", "header:x-tenant", "body:$.orderId"} {
+			_, err := newCSVWriter(&bytes.Buffer{}, []string{column})
+			assert.EqualError(t, err, fmt.Sprintf("Unknown CSV column %q", column))
+		}
+	})
+}
+
+func TestCommandExportCSV(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfileName := tmpfile.Name()
+	if err := tmpfile.Close(); err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(tmpfileName) // clean up
+
+	t.Run("Export as CSV", func(t *testing.T) {
+		amcmd := newTestCommand(&testConnection{}, WithCount(2), WithFile(tmpfileName),
+			WithFormat(FormatCSV), WithColumns("body", "redelivered"))
+		assert.NoError(t, amcmd.CommandExport("test"))
+		content, err := ioutil.ReadFile(tmpfileName)
+		assert.NoError(t, err)
+		assert.Equal(t, "body,redelivered\n1,false\n2,false\n", string(content))
+	})
+
+	t.Run("Error with unknown column", func(t *testing.T) {
+		amcmd := newTestCommand(&testConnection{}, WithCount(2), WithFile(tmpfileName),
+			WithFormat(FormatCSV), WithColumns("body", "size"))
+		assert.Error(t, amcmd.CommandExport("test"))
+	})
+}
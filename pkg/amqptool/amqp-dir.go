@@ -0,0 +1,273 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/streadway/amqp"
+)
+
+// DefaultFileName is the template of the file names of the messages
+// exported to a directory (see WithDirectory)
+const DefaultFileName = `{{printf "%06d" .Index}}`
+
+// metaExtension is the extension of the metadata sidecar files
+const metaExtension = ".meta.json"
+
+// unsafeFileChars are the characters replaced in the file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// contentExtensions are the file extensions of the usual content
+// types, before the ones known by the system
+var contentExtensions = map[string]string{
+	"application/json":         ".json",
+	"text/json":                ".json",
+	"application/xml":          ".xml",
+	"text/xml":                 ".xml",
+	"text/plain":               ".txt",
+	"text/csv":                 ".csv",
+	"text/html":                ".html",
+	"application/yaml":         ".yaml",
+	"application/x-yaml":       ".yaml",
+	"application/x-protobuf":   ".pb",
+	"application/protobuf":     ".pb",
+	"application/octet-stream": ".bin",
+}
+
+// messageMeta is the sidecar of a message exported to a directory:
+// the envelope without the body, and the name of the body file
+type messageMeta struct {
+	Exchange    string                `json:"exchange"`
+	RoutingKey  string                `json:"routing_key"`
+	Redelivered bool                  `json:"redelivered"`
+	Properties  envelopeProperties    `json:"properties"`
+	Headers     map[string]typedValue `json:"headers,omitempty"`
+	BodyFile    string                `json:"body_file"`
+}
+
+// contentExtension returns the file extension of a content type
+// (.bin when unknown)
+func contentExtension(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ".bin"
+	}
+	if ext, ok := contentExtensions[mediaType]; ok {
+		return ext
+	}
+	if strings.HasSuffix(mediaType, "+json") {
+		return ".json"
+	}
+	if strings.HasSuffix(mediaType, "+xml") {
+		return ".xml"
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		sort.Strings(exts)
+		return exts[0]
+	}
+	return ".bin"
+}
+
+// dirWriter writes every message body in its own file of the
+// directory, named with the template and the extension of the content
+// type, with a metadata sidecar
+type dirWriter struct {
+	dir   string
+	name  *template.Template
+	index int
+	used  map[string]bool
+	buf   bytes.Buffer
+}
+
+func (c *CommandInfo) newDirWriter() (*dirWriter, error) {
+	text := c.fileName
+	if text == "" {
+		text = DefaultFileName
+	}
+	name, err := parseTemplate(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid file name: %v", err)
+	}
+	return &dirWriter{dir: c.dir, name: name, used: map[string]bool{}}, nil
+}
+
+// begin creates the directory, that must be empty so no file of a
+// previous export is overwritten
+func (d *dirWriter) begin() error {
+	err := os.MkdirAll(d.dir, 0755)
+	if err != nil {
+		return fmt.Errorf("Failed to create the output directory: %v", err)
+	}
+	infos, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return fmt.Errorf("Failed to read the output directory: %v", err)
+	}
+	if len(infos) > 0 {
+		return fmt.Errorf("The output directory %s is not empty", d.dir)
+	}
+	return nil
+}
+
+// fileName returns the unique name, without extension, of the message
+func (d *dirWriter) fileName(msg amqp.Delivery, ext string) (string, error) {
+	d.buf.Reset()
+	err := d.name.Execute(&d.buf, newTemplateMessage(d.index, msg))
+	if err != nil {
+		return "", fmt.Errorf("Error rendering the file name: %v", err)
+	}
+	base := strings.Trim(unsafeFileChars.ReplaceAllString(d.buf.String(), "_"), ".")
+	if base == "" {
+		base = fmt.Sprintf("%06d", d.index)
+	}
+	if strings.HasSuffix(base+ext, metaExtension) {
+		// the body file would be read back as a metadata file
+		base += "_"
+	}
+	// unique by the name without extension, shared with the sidecar
+	name := base
+	for n := 2; d.used[name]; n++ {
+		name = fmt.Sprintf("%s-%d", base, n)
+	}
+	d.used[name] = true
+	return name, nil
+}
+
+func (d *dirWriter) write(msg amqp.Delivery) error {
+	ext := contentExtension(msg.ContentType)
+	name, err := d.fileName(msg, ext)
+	if err != nil {
+		return err
+	}
+	d.index++
+
+	env, err := newEnvelope(msg)
+	if err != nil {
+		return fmt.Errorf("Error encoding message: %v", err)
+	}
+	meta := messageMeta{
+		Exchange:    env.Exchange,
+		RoutingKey:  env.RoutingKey,
+		Redelivered: env.Redelivered,
+		Properties:  env.Properties,
+		Headers:     env.Headers,
+		BodyFile:    name + ext,
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error encoding message: %v", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(d.dir, name+ext), msg.Body, 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(d.dir, name+metaExtension), append(data, '\n'), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("Error writing message content in file: %v", err)
+	}
+	return nil
+}
+
+func (d *dirWriter) end() error {
+	return nil
+}
+
+// dirReader reads the messages of a directory export, in the order of
+// the names of the metadata files (numeric names by their value)
+type dirReader struct {
+	dir   string
+	metas []string
+}
+
+func newDirReader(dir string) (*dirReader, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading input directory: %v", err)
+	}
+	var metas []string
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), metaExtension) {
+			metas = append(metas, filepath.Join(dir, info.Name()))
+		}
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		return lessFileName(filepath.Base(metas[i]), filepath.Base(metas[j]))
+	})
+	return &dirReader{dir: dir, metas: metas}, nil
+}
+
+// lessFileName orders the numeric file names by their value, before
+// the other names in lexical order, so the default names keep the
+// order of the messages past the width of their padding
+func lessFileName(a, b string) bool {
+	na, erra := strconv.ParseUint(strings.TrimSuffix(a, metaExtension), 10, 64)
+	nb, errb := strconv.ParseUint(strings.TrimSuffix(b, metaExtension), 10, 64)
+	switch {
+	case erra == nil && errb == nil && na != nb:
+		return na < nb
+	case erra == nil && errb != nil:
+		return true
+	case erra != nil && errb == nil:
+		return false
+	}
+	return a < b
+}
+
+func (d *dirReader) read() (importedMessage, error) {
+	if len(d.metas) == 0 {
+		return importedMessage{}, io.EOF
+	}
+	file := d.metas[0]
+	d.metas = d.metas[1:]
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return importedMessage{}, fmt.Errorf("Error reading input: %v", err)
+	}
+	var meta messageMeta
+	if err = json.Unmarshal(data, &meta); err != nil {
+		return importedMessage{}, fmt.Errorf("Invalid message metadata %s: %v", filepath.Base(file), err)
+	}
+	env := envelope{
+		Exchange:    meta.Exchange,
+		RoutingKey:  meta.RoutingKey,
+		Redelivered: meta.Redelivered,
+		Properties:  meta.Properties,
+		Headers:     meta.Headers,
+	}
+	msg, err := env.publishing()
+	if err != nil {
+		return importedMessage{}, fmt.Errorf("Invalid message metadata %s: %v", filepath.Base(file), err)
+	}
+	if meta.BodyFile == "" || filepath.Base(meta.BodyFile) != meta.BodyFile {
+		return importedMessage{}, fmt.Errorf("Invalid message metadata %s: invalid body file %q", filepath.Base(file), meta.BodyFile)
+	}
+	msg.Body, err = ioutil.ReadFile(filepath.Join(d.dir, meta.BodyFile))
+	if err != nil {
+		return importedMessage{}, fmt.Errorf("Error reading input: %v", err)
+	}
+	return importedMessage{routingKey: meta.RoutingKey, msg: msg}, nil
+}
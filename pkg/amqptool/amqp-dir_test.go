@@ -0,0 +1,196 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentExtension(t *testing.T) {
+	tests := map[string]string{
+		"":                                ".bin",
+		"application/json":                ".json",
+		"application/json; charset=utf-8": ".json",
+		"application/vnd.api+json":        ".json",
+		"application/soap+xml":            ".xml",
+		"text/plain":                      ".txt",
+		"application/octet-stream":        ".bin",
+		"application/x-unknown-type":      ".bin",
+		"invalid/type/x":                  ".bin",
+	}
+	for contentType, ext := range tests {
+		assert.Equal(t, ext, contentExtension(contentType), contentType)
+	}
+}
+
+func TestCommandExportDirectory(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	deliveries := []amqp.Delivery{
+		{DeliveryTag: 1, RoutingKey: "order.created", MessageId: "o-1", ContentType: "application/json",
+			Timestamp: ts, Headers: amqp.Table{"x-tenant": "acme", "x-retries": int32(2)}, Body: []byte(`{"id":1}`)},
+		{DeliveryTag: 2, RoutingKey: "order.created", MessageId: "o-1", ContentType: "application/json", Body: []byte(`{"id":2}`)},
+		{DeliveryTag: 3, RoutingKey: "order.note", MessageId: "../n/1", ContentType: "text/plain", Body: []byte("note")},
+		{DeliveryTag: 4, RoutingKey: "order.raw", Body: []byte{0xff, 0x00}},
+	}
+
+	t.Run("Export with the default names", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		amcmd := newTestCommand(&testConnection{deliveries: deliveries}, WithUntilEmpty(true),
+			WithDirectory(filepath.Join(dir, "out")))
+		assert.NoError(t, amcmd.CommandExport("test"))
+		assert.Equal(t, 4, amcmd.Processed())
+		assert.Equal(t, []string{"000000.json", "000000.meta.json", "000001.json", "000001.meta.json",
+			"000002.meta.json", "000002.txt", "000003.bin", "000003.meta.json"}, dirFiles(t, filepath.Join(dir, "out")))
+
+		body, err := ioutil.ReadFile(filepath.Join(dir, "out", "000003.bin"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0xff, 0x00}, body)
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "out", "000000.meta.json"))
+		assert.NoError(t, err)
+		var meta map[string]interface{}
+		assert.NoError(t, json.Unmarshal(data, &meta))
+		assert.Equal(t, "000000.json", meta["body_file"])
+		assert.Equal(t, "order.created", meta["routing_key"])
+		assert.Contains(t, meta["headers"], "x-tenant")
+		assert.NotContains(t, meta, "body")
+	})
+
+	t.Run("Export with a file name template", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		amcmd := newTestCommand(&testConnection{deliveries: deliveries}, WithUntilEmpty(true), WithDirectory(dir),
+			WithFileName(`{{default "none" .MessageId}}`))
+		assert.NoError(t, amcmd.CommandExport("test"))
+		assert.Equal(t, []string{"_n_1.meta.json", "_n_1.txt", "none.bin", "none.meta.json",
+			"o-1-2.json", "o-1-2.meta.json", "o-1.json", "o-1.meta.json"}, dirFiles(t, dir))
+	})
+
+	t.Run("Import the directory", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		amcmd := newTestCommand(&testConnection{deliveries: deliveries}, WithUntilEmpty(true), WithDirectory(dir))
+		assert.NoError(t, amcmd.CommandExport("test"))
+
+		tconn := testConnection{}
+		imp := newTestCommand(&tconn, WithExchange(""))
+		assert.NoError(t, imp.CommandImport(dir, "orders"))
+		assert.Len(t, tconn.published, 4)
+		assert.Equal(t, []string{"orders/order.created", "orders/order.created", "orders/order.note", "orders/order.raw"}, tconn.routes)
+		first := tconn.published[0]
+		assert.Equal(t, amqp.Table{"x-tenant": "acme", "x-retries": int32(2)}, first.Headers)
+		assert.Equal(t, "o-1", first.MessageId)
+		assert.Equal(t, "application/json", first.ContentType)
+		assert.True(t, ts.Equal(first.Timestamp))
+		assert.Equal(t, []byte(`{"id":1}`), first.Body)
+		assert.Equal(t, []byte{0xff, 0x00}, tconn.published[3].Body)
+	})
+
+	t.Run("Export the same name with other extensions", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		amcmd := newTestCommand(&testConnection{deliveries: deliveries}, WithUntilEmpty(true), WithDirectory(dir),
+			WithFileName(`{{if eq .Index 1}}order.meta{{else}}order{{end}}`))
+		assert.NoError(t, amcmd.CommandExport("test"))
+		assert.Equal(t, []string{"order-2.meta.json", "order-2.txt", "order-3.bin", "order-3.meta.json",
+			"order.json", "order.meta.json", "order.meta_.json", "order.meta_.meta.json"}, dirFiles(t, dir))
+
+		tconn := testConnection{}
+		assert.NoError(t, newTestCommand(&tconn, WithExchange("")).CommandImport(dir, "orders"))
+		assert.Len(t, tconn.published, 4)
+	})
+
+	t.Run("Import past the padding of the default names", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		for _, name := range []string{"1000000", "999999", "extra"} {
+			meta := `{"routing_key":"` + name + `","body_file":"` + name + `.txt"}`
+			if err := ioutil.WriteFile(filepath.Join(dir, name+".meta.json"), []byte(meta), 0644); err != nil {
+				log.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, name+".txt"), []byte(name), 0644); err != nil {
+				log.Fatal(err)
+			}
+		}
+		tconn := testConnection{}
+		assert.NoError(t, newTestCommand(&tconn, WithExchange("")).CommandImport(dir, "orders"))
+		assert.Equal(t, []string{"orders/999999", "orders/1000000", "orders/extra"}, tconn.routes)
+	})
+
+	t.Run("Import a directory with glob characters", func(t *testing.T) {
+		dir := filepath.Join(testTempDir(), "orders[1]*?")
+		defer os.RemoveAll(filepath.Dir(dir))
+		amcmd := newTestCommand(&testConnection{deliveries: deliveries}, WithUntilEmpty(true), WithDirectory(dir))
+		assert.NoError(t, amcmd.CommandExport("test"))
+
+		tconn := testConnection{}
+		assert.NoError(t, newTestCommand(&tconn, WithExchange("")).CommandImport(dir, "orders"))
+		assert.Len(t, tconn.published, 4)
+	})
+
+	t.Run("Error exporting to a non empty directory", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		assert.NoError(t, newTestCommand(&testConnection{deliveries: deliveries}, WithUntilEmpty(true),
+			WithDirectory(dir)).CommandExport("test"))
+
+		tconn := testConnection{deliveries: deliveries}
+		amcmd := newTestCommand(&tconn, WithUntilEmpty(true), WithDirectory(dir))
+		assert.Error(t, amcmd.CommandExport("test"))
+		assert.Equal(t, 0, amcmd.Processed())
+	})
+
+	t.Run("Error with invalid file name template", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		amcmd := newTestCommand(&testConnection{deliveries: deliveries}, WithUntilEmpty(true), WithDirectory(dir),
+			WithFileName("{{.Index"))
+		assert.Error(t, amcmd.CommandExport("test"))
+	})
+
+	t.Run("Error importing invalid metadata", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		imp := newTestCommand(&testConnection{})
+		for _, content := range []string{`invalid`, `{"body_file":"../secret"}`, `{"body_file":"missing.bin"}`} {
+			if err := ioutil.WriteFile(filepath.Join(dir, "1.meta.json"), []byte(content), 0644); err != nil {
+				log.Fatal(err)
+			}
+			assert.Error(t, imp.CommandImport(dir, "orders"), content)
+		}
+	})
+}
+
+// dirFiles returns the sorted names of the files of the directory
+func dirFiles(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,137 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// endpoint is one side of a command, the source or the destiny of the
+// messages, with its own connection and channel. The channel is
+// prepared by setup every time the endpoint is opened, so a lost
+// connection can be reopened in the same state.
+type endpoint struct {
+	name     string
+	settings ConnectionSettings
+	dialer   Dialer
+	setup    func(ch Channel) error
+	conn     Connection
+	ch       Channel
+	failures int
+}
+
+// source returns the endpoint to consume the messages from
+func (c *CommandInfo) source() *endpoint {
+	return &endpoint{name: "source", settings: c.connection, dialer: c.dialer}
+}
+
+// destination returns the endpoint to publish the messages to, the
+// same broker than the source unless a destination is configured
+func (c *CommandInfo) destination() *endpoint {
+	e := &endpoint{name: "destiny", settings: c.connection, dialer: c.dialer}
+	if c.dstConnection != nil {
+		e.settings = *c.dstConnection
+	}
+	if c.dstDialer != nil {
+		e.dialer = c.dstDialer
+	}
+	return e
+}
+
+// open connects the endpoint and prepares its channel, closing the
+// previous connection if any
+func (c *CommandInfo) open(ctx context.Context, e *endpoint) error {
+	e.close()
+
+	url, err := e.settings.url()
+	if err != nil {
+		return err
+	}
+	conn, err := e.dialer(ctx, url)
+	if err != nil {
+		if ctx.Err() != nil {
+			return c.canceled(ctx)
+		}
+		return fmt.Errorf("Failed to connect to the %s RabbitMQ: %v", e.name, err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("Failed to open a %s channel: %v", e.name, err)
+	}
+	e.conn, e.ch = conn, ch
+
+	if e.setup != nil {
+		err = e.setup(ch)
+		if err != nil {
+			e.close()
+			return err
+		}
+	}
+	return nil
+}
+
+// close closes the channel and connection of the endpoint
+func (e *endpoint) close() {
+	if e.ch != nil {
+		e.ch.Close()
+		e.ch = nil
+	}
+	if e.conn != nil {
+		e.conn.Close()
+		e.conn = nil
+	}
+}
+
+// reconnect reopens the endpoint after the failure, waiting the
+// reconnect delay before every attempt. The attempts are counted until
+// the endpoint is used again successfully (see progress). Without
+// reconnections enabled, or when the command is interrupted, the
+// failure is returned.
+func (c *CommandInfo) reconnect(ctx context.Context, e *endpoint, failure error) error {
+	if c.reconnectAttempts <= 0 {
+		return failure
+	}
+	for e.failures < c.reconnectAttempts {
+		e.failures++
+		timer := time.NewTimer(c.reconnectDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return c.canceled(ctx)
+		case <-c.interrupted():
+			timer.Stop()
+			return failure
+		}
+
+		err := c.open(ctx, e)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(*CanceledError); ok {
+			return err
+		}
+		failure = err
+	}
+	return fmt.Errorf("Failed to reconnect the %s after %d attempts: %v", e.name, c.reconnectAttempts, failure)
+}
+
+// progress resets the reconnection attempts once the endpoint works
+func (e *endpoint) progress() {
+	e.failures = 0
+}
@@ -0,0 +1,324 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	bodyEncodingUTF8   = "utf8"
+	bodyEncodingBase64 = "base64"
+)
+
+// envelope is the serializable representation of a message: the
+// routing information, every property and header and the body
+type envelope struct {
+	Exchange     string                `json:"exchange"`
+	RoutingKey   string                `json:"routing_key"`
+	Redelivered  bool                  `json:"redelivered"`
+	Properties   envelopeProperties    `json:"properties"`
+	Headers      map[string]typedValue `json:"headers,omitempty"`
+	Body         string                `json:"body"`
+	BodyEncoding string                `json:"body_encoding"`
+}
+
+// envelopeProperties are the basic properties of an amqp message
+type envelopeProperties struct {
+	ContentType     string     `json:"content_type,omitempty"`
+	ContentEncoding string     `json:"content_encoding,omitempty"`
+	DeliveryMode    uint8      `json:"delivery_mode,omitempty"`
+	Priority        uint8      `json:"priority,omitempty"`
+	CorrelationID   string     `json:"correlation_id,omitempty"`
+	ReplyTo         string     `json:"reply_to,omitempty"`
+	Expiration      string     `json:"expiration,omitempty"`
+	MessageID       string     `json:"message_id,omitempty"`
+	Timestamp       *time.Time `json:"timestamp,omitempty"`
+	Type            string     `json:"type,omitempty"`
+	UserID          string     `json:"user_id,omitempty"`
+	AppID           string     `json:"app_id,omitempty"`
+}
+
+// typedValue keeps the amqp type of a header value, so it can be
+// restored without loss (e.g. int16 vs int64, or timestamps vs
+// strings)
+type typedValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// newEnvelope builds the envelope for a delivery
+func newEnvelope(msg amqp.Delivery) (envelope, error) {
+	env := envelope{
+		Exchange:    msg.Exchange,
+		RoutingKey:  msg.RoutingKey,
+		Redelivered: msg.Redelivered,
+		Properties: envelopeProperties{
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			DeliveryMode:    msg.DeliveryMode,
+			Priority:        msg.Priority,
+			CorrelationID:   msg.CorrelationId,
+			ReplyTo:         msg.ReplyTo,
+			Expiration:      msg.Expiration,
+			MessageID:       msg.MessageId,
+			Type:            msg.Type,
+			UserID:          msg.UserId,
+			AppID:           msg.AppId,
+		},
+	}
+	if !msg.Timestamp.IsZero() {
+		ts := msg.Timestamp.UTC()
+		env.Properties.Timestamp = &ts
+	}
+
+	if len(msg.Headers) > 0 {
+		headers, err := encodeTable(msg.Headers)
+		if err != nil {
+			return env, err
+		}
+		env.Headers = headers
+	}
+
+	if utf8.Valid(msg.Body) {
+		env.Body = string(msg.Body)
+		env.BodyEncoding = bodyEncodingUTF8
+	} else {
+		env.Body = base64.StdEncoding.EncodeToString(msg.Body)
+		env.BodyEncoding = bodyEncodingBase64
+	}
+	return env, nil
+}
+
+// publishing restores the message described by the envelope
+func (e envelope) publishing() (amqp.Publishing, error) {
+	msg := amqp.Publishing{
+		ContentType:     e.Properties.ContentType,
+		ContentEncoding: e.Properties.ContentEncoding,
+		DeliveryMode:    e.Properties.DeliveryMode,
+		Priority:        e.Properties.Priority,
+		CorrelationId:   e.Properties.CorrelationID,
+		ReplyTo:         e.Properties.ReplyTo,
+		Expiration:      e.Properties.Expiration,
+		MessageId:       e.Properties.MessageID,
+		Type:            e.Properties.Type,
+		UserId:          e.Properties.UserID,
+		AppId:           e.Properties.AppID,
+	}
+	if e.Properties.Timestamp != nil {
+		msg.Timestamp = *e.Properties.Timestamp
+	}
+
+	if e.Headers != nil {
+		headers, err := decodeTable(e.Headers)
+		if err != nil {
+			return msg, err
+		}
+		msg.Headers = headers
+	}
+
+	switch e.BodyEncoding {
+	case bodyEncodingUTF8, "":
+		msg.Body = []byte(e.Body)
+	case bodyEncodingBase64:
+		body, err := base64.StdEncoding.DecodeString(e.Body)
+		if err != nil {
+			return msg, fmt.Errorf("Invalid base64 body: %v", err)
+		}
+		msg.Body = body
+	default:
+		return msg, fmt.Errorf("Unknown body encoding %q", e.BodyEncoding)
+	}
+	return msg, nil
+}
+
+// encodeTable encodes all the fields of an amqp table
+func encodeTable(table amqp.Table) (map[string]typedValue, error) {
+	result := make(map[string]typedValue, len(table))
+	keys := make([]string, 0, len(table))
+	for k := range table {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, err := encodeField(table[k])
+		if err != nil {
+			return nil, fmt.Errorf("Header %q: %v", k, err)
+		}
+		result[k] = v
+	}
+	return result, nil
+}
+
+// decodeTable restores an amqp table from its encoded fields
+func decodeTable(fields map[string]typedValue) (amqp.Table, error) {
+	table := make(amqp.Table, len(fields))
+	for k, f := range fields {
+		v, err := decodeField(f)
+		if err != nil {
+			return nil, fmt.Errorf("Header %q: %v", k, err)
+		}
+		table[k] = v
+	}
+	return table, nil
+}
+
+// encodeField encodes any value supported in an amqp table
+func encodeField(value interface{}) (typedValue, error) {
+	var kind string
+	var raw interface{} = value
+
+	switch v := value.(type) {
+	case nil:
+		return typedValue{Type: "void"}, nil
+	case bool:
+		kind = "bool"
+	case byte:
+		kind = "byte"
+	case int16:
+		kind = "int16"
+	case int32:
+		kind = "int32"
+	case int64:
+		kind = "int64"
+	case float32:
+		kind = "float32"
+	case float64:
+		kind = "float64"
+	case string:
+		kind = "string"
+	case []byte:
+		kind = "bytes"
+	case amqp.Decimal:
+		kind = "decimal"
+	case time.Time:
+		kind = "timestamp"
+		raw = v.UTC()
+	case []interface{}:
+		kind = "array"
+		values := make([]typedValue, 0, len(v))
+		for _, item := range v {
+			tv, err := encodeField(item)
+			if err != nil {
+				return typedValue{}, err
+			}
+			values = append(values, tv)
+		}
+		raw = values
+	case amqp.Table:
+		kind = "table"
+		fields, err := encodeTable(v)
+		if err != nil {
+			return typedValue{}, err
+		}
+		raw = fields
+	default:
+		return typedValue{}, fmt.Errorf("Unsupported value type %T", value)
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return typedValue{}, err
+	}
+	return typedValue{Type: kind, Value: data}, nil
+}
+
+// decodeField restores a value with its original amqp type
+func decodeField(f typedValue) (interface{}, error) {
+	var err error
+	var value interface{}
+
+	switch f.Type {
+	case "void":
+		return nil, nil
+	case "bool":
+		var v bool
+		err = json.Unmarshal(f.Value, &v)
+		value = v
+	case "byte":
+		var v byte
+		err = json.Unmarshal(f.Value, &v)
+		value = v
+	case "int16":
+		var v int16
+		err = json.Unmarshal(f.Value, &v)
+		value = v
+	case "int32":
+		var v int32
+		err = json.Unmarshal(f.Value, &v)
+		value = v
+	case "int64":
+		var v int64
+		err = json.Unmarshal(f.Value, &v)
+		value = v
+	case "float32":
+		var v float32
+		err = json.Unmarshal(f.Value, &v)
+		value = v
+	case "float64":
+		var v float64
+		err = json.Unmarshal(f.Value, &v)
+		value = v
+	case "string":
+		var v string
+		err = json.Unmarshal(f.Value, &v)
+		value = v
+	case "bytes":
+		var v []byte
+		err = json.Unmarshal(f.Value, &v)
+		value = v
+	case "decimal":
+		var v amqp.Decimal
+		err = json.Unmarshal(f.Value, &v)
+		value = v
+	case "timestamp":
+		var v time.Time
+		err = json.Unmarshal(f.Value, &v)
+		value = v
+	case "array":
+		var items []typedValue
+		if err = json.Unmarshal(f.Value, &items); err != nil {
+			break
+		}
+		values := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			v, err := decodeField(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		value = values
+	case "table":
+		var fields map[string]typedValue
+		if err = json.Unmarshal(f.Value, &fields); err != nil {
+			break
+		}
+		value, err = decodeTable(fields)
+	default:
+		return nil, fmt.Errorf("Unknown value type %q", f.Type)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s value: %v", f.Type, err)
+	}
+	return value, nil
+}
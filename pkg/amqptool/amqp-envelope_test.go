@@ -0,0 +1,165 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// -- TEST DATA ----------------------------------------------------------------
+// -----------------------------------------------------------------------------
+var testTimestamp = time.Date(2019, 11, 5, 10, 30, 0, 0, time.UTC)
+
+var testDelivery = amqp.Delivery{
+	Exchange:        "orders",
+	RoutingKey:      "order.created",
+	Redelivered:     true,
+	ContentType:     "application/json",
+	ContentEncoding: "identity",
+	DeliveryMode:    amqp.Persistent,
+	Priority:        5,
+	CorrelationId:   "corr-1",
+	ReplyTo:         "replies",
+	Expiration:      "60000",
+	MessageId:       "msg-1",
+	Timestamp:       testTimestamp,
+	Type:            "order",
+	UserId:          "guest",
+	AppId:           "shop",
+	Headers: amqp.Table{
+		"void":      nil,
+		"bool":      true,
+		"byte":      byte(7),
+		"int16":     int16(-16),
+		"int32":     int32(32),
+		"int64":     int64(math.MaxInt64),
+		"float32":   float32(1.1),
+		"float64":   float64(2.2),
+		"string":    "acme",
+		"bytes":     []byte{0, 1, 2, 255},
+		"decimal":   amqp.Decimal{Scale: 2, Value: 1234},
+		"timestamp": testTimestamp,
+		"array":     []interface{}{"a", int32(1), amqp.Table{"nested": int64(2)}},
+		"table":     amqp.Table{"x-tenant": "acme", "inner": amqp.Table{"flag": false}},
+	},
+	Body: []byte(`{"id":1}`),
+}
+
+// -----------------------------------------------------------------------------
+// -- TEST START ---------------------------------------------------------------
+// -----------------------------------------------------------------------------
+func TestEnvelope(t *testing.T) {
+
+	t.Run("Round trip through JSON", func(t *testing.T) {
+		env, err := newEnvelope(testDelivery)
+		assert.NoError(t, err)
+		assert.Equal(t, bodyEncodingUTF8, env.BodyEncoding)
+		assert.Equal(t, `{"id":1}`, env.Body)
+
+		data, err := json.Marshal(env)
+		assert.NoError(t, err)
+
+		var decoded envelope
+		assert.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, "orders", decoded.Exchange)
+		assert.Equal(t, "order.created", decoded.RoutingKey)
+		assert.True(t, decoded.Redelivered)
+
+		msg, err := decoded.publishing()
+		assert.NoError(t, err)
+		assert.Equal(t, amqp.Publishing{
+			Headers:         testDelivery.Headers,
+			ContentType:     testDelivery.ContentType,
+			ContentEncoding: testDelivery.ContentEncoding,
+			DeliveryMode:    testDelivery.DeliveryMode,
+			Priority:        testDelivery.Priority,
+			CorrelationId:   testDelivery.CorrelationId,
+			ReplyTo:         testDelivery.ReplyTo,
+			Expiration:      testDelivery.Expiration,
+			MessageId:       testDelivery.MessageId,
+			Timestamp:       testDelivery.Timestamp,
+			Type:            testDelivery.Type,
+			UserId:          testDelivery.UserId,
+			AppId:           testDelivery.AppId,
+			Body:            testDelivery.Body,
+		}, msg)
+	})
+
+	t.Run("Binary body encoded in base64", func(t *testing.T) {
+		env, err := newEnvelope(amqp.Delivery{Body: []byte{0xff, 0xfe, 0x00}})
+		assert.NoError(t, err)
+		assert.Equal(t, bodyEncodingBase64, env.BodyEncoding)
+		assert.Equal(t, "//4A", env.Body)
+		assert.Nil(t, env.Headers)
+		assert.Nil(t, env.Properties.Timestamp)
+
+		msg, err := env.publishing()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0xff, 0xfe, 0x00}, msg.Body)
+		assert.Nil(t, msg.Headers)
+		assert.True(t, msg.Timestamp.IsZero())
+	})
+
+	t.Run("Typed header values", func(t *testing.T) {
+		tv, err := encodeField(int16(3))
+		assert.NoError(t, err)
+		assert.Equal(t, `{"type":"int16","value":3}`, marshalString(t, tv))
+
+		tv, err = encodeField(testTimestamp)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"type":"timestamp","value":"2019-11-05T10:30:00Z"}`, marshalString(t, tv))
+
+		tv, err = encodeField(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"type":"void"}`, marshalString(t, tv))
+	})
+
+	t.Run("Error with unsupported header type", func(t *testing.T) {
+		_, err := newEnvelope(amqp.Delivery{Headers: amqp.Table{"int": 1}})
+		assert.Error(t, err)
+	})
+
+	t.Run("Error with unknown header type", func(t *testing.T) {
+		env := envelope{Headers: map[string]typedValue{"x": {Type: "unknown"}}}
+		_, err := env.publishing()
+		assert.Error(t, err)
+	})
+
+	t.Run("Error with invalid header value", func(t *testing.T) {
+		env := envelope{Headers: map[string]typedValue{"x": {Type: "int16", Value: json.RawMessage(`"text"`)}}}
+		_, err := env.publishing()
+		assert.Error(t, err)
+	})
+
+	t.Run("Error with invalid body", func(t *testing.T) {
+		_, err := envelope{Body: "%%%", BodyEncoding: bodyEncodingBase64}.publishing()
+		assert.Error(t, err)
+
+		_, err = envelope{Body: "body", BodyEncoding: "rot13"}.publishing()
+		assert.Error(t, err)
+	})
+}
+
+func marshalString(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	return string(data)
+}
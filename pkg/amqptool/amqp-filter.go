@@ -0,0 +1,359 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Filter operators
+const (
+	OpEqual        = "="
+	OpNotEqual     = "!="
+	OpMatch        = "~"
+	OpNotMatch     = "!~"
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+)
+
+// Prefixes of the header and JSON body fields
+const (
+	headerFieldPrefix = "headers."
+	bodyFieldPrefix   = "body."
+)
+
+// messageFields are the routing fields and properties of a delivery
+// that can be used in a filter, with the envelope names
+var messageFields = []string{
+	"exchange", "routing_key", "redelivered",
+	"content_type", "content_encoding", "delivery_mode", "priority",
+	"correlation_id", "reply_to", "expiration", "message_id",
+	"timestamp", "type", "user_id", "app_id", "body",
+}
+
+// Filter is a condition on a message field, e.g. headers.x-tenant=acme
+// or timestamp>=2024-01-01. The fields are the routing key, exchange
+// and redelivered flag, the properties with the envelope names
+// (content_type, app_id, ...), headers.NAME for a header, body for
+// the whole body and body.PATH for a field of a JSON body (with a dot
+// separated path, e.g. body.order.lines.0.sku). The values are
+// compared as timestamps (RFC 3339 or dates), numbers or text, and the
+// ~ and !~ operators match a regular expression. A missing field only
+// satisfies the != and !~ operators.
+type Filter struct {
+	Field    string
+	Operator string
+	Value    string
+
+	re     *regexp.Regexp
+	number float64
+	isNum  bool
+	time   time.Time
+	isTime bool
+}
+
+// ParseFilter parses a filter expression: a field, an operator and
+// the value
+func ParseFilter(expr string) (Filter, error) {
+	i := strings.IndexAny(expr, "=!~<>")
+	if i <= 0 {
+		return Filter{}, fmt.Errorf("Invalid filter %q: expected field, operator and value", expr)
+	}
+	op := expr[i : i+1]
+	if i+1 < len(expr) {
+		switch two := expr[i : i+2]; two {
+		case OpNotEqual, OpNotMatch, OpGreaterEqual, OpLessEqual:
+			op = two
+		}
+	}
+	if op == "!" {
+		return Filter{}, fmt.Errorf("Invalid filter %q: unknown operator", expr)
+	}
+
+	f := Filter{Field: strings.TrimSpace(expr[:i]), Operator: op, Value: expr[i+len(op):]}
+	if !validField(f.Field) {
+		return Filter{}, fmt.Errorf("Invalid filter %q: unknown field %q", expr, f.Field)
+	}
+
+	switch op {
+	case OpMatch, OpNotMatch:
+		re, err := regexp.Compile(f.Value)
+		if err != nil {
+			return Filter{}, fmt.Errorf("Invalid filter %q: %v", expr, err)
+		}
+		f.re = re
+	default:
+		if n, err := strconv.ParseFloat(f.Value, 64); err == nil {
+			f.number, f.isNum = n, true
+		}
+		if t, ok := parseTime(f.Value); ok {
+			f.time, f.isTime = t, true
+		}
+	}
+	return f, nil
+}
+
+// validField checks the field is known
+func validField(field string) bool {
+	if strings.HasPrefix(field, headerFieldPrefix) && len(field) > len(headerFieldPrefix) ||
+		strings.HasPrefix(field, bodyFieldPrefix) && len(field) > len(bodyFieldPrefix) {
+		return true
+	}
+	for _, f := range messageFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTime parses a timestamp or a date
+func parseTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Match checks the filter condition in the message
+func (f Filter) Match(msg amqp.Delivery) bool {
+	return f.match(&deliveryFields{msg: msg})
+}
+
+func (f Filter) match(d *deliveryFields) bool {
+	v, ok := d.value(f.Field)
+	if !ok {
+		return f.Operator == OpNotEqual || f.Operator == OpNotMatch
+	}
+
+	switch f.Operator {
+	case OpMatch:
+		return f.re.MatchString(formatValue(v))
+	case OpNotMatch:
+		return !f.re.MatchString(formatValue(v))
+	}
+
+	cmp := f.compare(v)
+	switch f.Operator {
+	case OpEqual:
+		return cmp == 0
+	case OpNotEqual:
+		return cmp != 0
+	case OpGreater:
+		return cmp > 0
+	case OpGreaterEqual:
+		return cmp >= 0
+	case OpLess:
+		return cmp < 0
+	case OpLessEqual:
+		return cmp <= 0
+	}
+	return false
+}
+
+// compare compares the field value with the filter value, as
+// timestamps or numbers when both are, or as text
+func (f Filter) compare(v interface{}) int {
+	switch x := v.(type) {
+	case time.Time:
+		if f.isTime {
+			switch {
+			case x.Before(f.time):
+				return -1
+			case x.After(f.time):
+				return 1
+			}
+			return 0
+		}
+	case float64:
+		if f.isNum {
+			return compareNumbers(x, f.number)
+		}
+	case string:
+		if f.isNum {
+			if n, err := strconv.ParseFloat(x, 64); err == nil {
+				return compareNumbers(n, f.number)
+			}
+		}
+	}
+	return strings.Compare(formatValue(v), f.Value)
+}
+
+func compareNumbers(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// matchAll checks all the filters in the message
+func matchAll(filters []Filter, msg amqp.Delivery) bool {
+	d := &deliveryFields{msg: msg}
+	for _, f := range filters {
+		if !f.match(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// deliveryFields resolves the field values of a delivery, decoding the
+// JSON body only once. The values are strings, float64 numbers, bools,
+// timestamps, nil, or the decoded JSON objects and arrays.
+type deliveryFields struct {
+	msg     amqp.Delivery
+	body    interface{}
+	decoded bool
+	bodyOK  bool
+}
+
+// value returns the value of a field, and if the message has it
+func (d *deliveryFields) value(field string) (interface{}, bool) {
+	msg := d.msg
+	switch field {
+	case "exchange":
+		return msg.Exchange, true
+	case "routing_key":
+		return msg.RoutingKey, true
+	case "redelivered":
+		return msg.Redelivered, true
+	case "content_type":
+		return msg.ContentType, msg.ContentType != ""
+	case "content_encoding":
+		return msg.ContentEncoding, msg.ContentEncoding != ""
+	case "delivery_mode":
+		return float64(msg.DeliveryMode), true
+	case "priority":
+		return float64(msg.Priority), true
+	case "correlation_id":
+		return msg.CorrelationId, msg.CorrelationId != ""
+	case "reply_to":
+		return msg.ReplyTo, msg.ReplyTo != ""
+	case "expiration":
+		return msg.Expiration, msg.Expiration != ""
+	case "message_id":
+		return msg.MessageId, msg.MessageId != ""
+	case "timestamp":
+		return msg.Timestamp, !msg.Timestamp.IsZero()
+	case "type":
+		return msg.Type, msg.Type != ""
+	case "user_id":
+		return msg.UserId, msg.UserId != ""
+	case "app_id":
+		return msg.AppId, msg.AppId != ""
+	case "body":
+		return string(msg.Body), true
+	}
+
+	if strings.HasPrefix(field, headerFieldPrefix) {
+		v, ok := msg.Headers[field[len(headerFieldPrefix):]]
+		if !ok {
+			return nil, false
+		}
+		return headerValue(v), true
+	}
+
+	if strings.HasPrefix(field, bodyFieldPrefix) {
+		if !d.decoded {
+			d.decoded = true
+			d.bodyOK = json.Unmarshal(msg.Body, &d.body) == nil
+		}
+		if !d.bodyOK {
+			return nil, false
+		}
+		return jsonPath(d.body, strings.Split(field[len(bodyFieldPrefix):], "."))
+	}
+	return nil, false
+}
+
+// headerValue normalizes the value of a header
+func headerValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case byte:
+		return float64(x)
+	case int16:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case float32:
+		return float64(x)
+	case []byte:
+		return string(x)
+	case amqp.Decimal:
+		return float64(x.Value) / math.Pow10(int(x.Scale))
+	}
+	return v
+}
+
+// jsonPath returns the value in the path of a decoded JSON document
+func jsonPath(doc interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			doc = v
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// formatValue returns the text of a field value
+func formatValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	case time.Time:
+		return x.UTC().Format(time.RFC3339Nano)
+	case []interface{}, map[string]interface{}, amqp.Table:
+		data, err := json.Marshal(x)
+		if err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprint(v)
+}
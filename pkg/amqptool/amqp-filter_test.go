@@ -0,0 +1,130 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expr  string
+		field string
+		op    string
+		value string
+	}{
+		{"headers.x-tenant=acme", "headers.x-tenant", OpEqual, "acme"},
+		{"type!=order", "type", OpNotEqual, "order"},
+		{"body~^err", "body", OpMatch, "^err"},
+		{"body!~debug", "body", OpNotMatch, "debug"},
+		{"priority>3", "priority", OpGreater, "3"},
+		{"timestamp>=2024-01-01", "timestamp", OpGreaterEqual, "2024-01-01"},
+		{"body.total<10.5", "body.total", OpLess, "10.5"},
+		{"body.total<=10", "body.total", OpLessEqual, "10"},
+		{"app_id=", "app_id", OpEqual, ""},
+		{" routing_key =a=b", "routing_key", OpEqual, "a=b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := ParseFilter(tt.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.field, f.Field)
+			assert.Equal(t, tt.op, f.Operator)
+			assert.Equal(t, tt.value, f.Value)
+		})
+	}
+
+	for _, expr := range []string{"", "=acme", "type", "unknown=1", "headers.=1", "body.=1", "body~(", "type!acme"} {
+		t.Run("Error "+expr, func(t *testing.T) {
+			_, err := ParseFilter(expr)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	msg := amqp.Delivery{
+		RoutingKey:  "order.created",
+		ContentType: "application/json",
+		Priority:    5,
+		Timestamp:   time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		AppId:       "shop",
+		Headers: amqp.Table{
+			"x-tenant":  "acme",
+			"x-retries": int32(3),
+			"x-raw":     []byte("bytes"),
+			"x-price":   amqp.Decimal{Scale: 2, Value: 1250},
+		},
+		Body: []byte(`{"order":{"id":"o-1","total":99.5,"paid":true,"lines":[{"sku":"A1"}]}}`),
+	}
+
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{"headers.x-tenant=acme", true},
+		{"headers.x-tenant=other", false},
+		{"headers.x-tenant!=other", true},
+		{"headers.x-missing!=acme", true},
+		{"headers.x-missing=acme", false},
+		{"headers.x-missing!~.", true},
+		{"headers.x-retries>=3", true},
+		{"headers.x-retries>3", false},
+		{"headers.x-raw=bytes", true},
+		{"headers.x-price=12.5", true},
+		{"routing_key~^order\\.", true},
+		{"content_type=application/json", true},
+		{"type=order", false},
+		{"app_id=shop", true},
+		{"priority>4", true},
+		{"timestamp>=2024-03-01", true},
+		{"timestamp<2024-03-01T12:00:00Z", false},
+		{"timestamp<=2024-03-01T12:00:00Z", true},
+		{"redelivered=false", true},
+		{"body~\"paid\":true", true},
+		{"body.order.id=o-1", true},
+		{"body.order.total>99", true},
+		{"body.order.total=99.5", true},
+		{"body.order.paid=true", true},
+		{"body.order.lines.0.sku=A1", true},
+		{"body.order.lines.1.sku=A1", false},
+		{"body.order.missing!=x", true},
+		{"body.order.lines~A1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := ParseFilter(tt.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.match, f.Match(msg))
+		})
+	}
+
+	t.Run("Body not JSON", func(t *testing.T) {
+		f, err := ParseFilter("body.id=1")
+		assert.NoError(t, err)
+		assert.False(t, f.Match(amqp.Delivery{Body: []byte("plain")}))
+	})
+
+	t.Run("All filters", func(t *testing.T) {
+		f1, _ := ParseFilter("headers.x-tenant=acme")
+		f2, _ := ParseFilter("priority<5")
+		assert.False(t, matchAll([]Filter{f1, f2}, msg))
+		assert.True(t, matchAll([]Filter{f1}, msg))
+		assert.True(t, matchAll(nil, msg))
+	})
+}
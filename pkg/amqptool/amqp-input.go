@@ -0,0 +1,193 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/streadway/amqp"
+)
+
+// maxMessageSize is the biggest message accepted when importing,
+// the default limit of RabbitMQ
+const maxMessageSize = 128 * 1024 * 1024
+
+// importedMessage is a message read from an exported file, with the
+// routing key it was originally published with (if known)
+type importedMessage struct {
+	routingKey string
+	msg        amqp.Publishing
+}
+
+// messageReader reads the messages from an exported file, returning
+// io.EOF when there are no more messages
+type messageReader interface {
+	read() (importedMessage, error)
+}
+
+// newMessageReader creates the reader for the configured format
+func (c *CommandInfo) newMessageReader(r io.Reader) (messageReader, error) {
+	switch c.format {
+	case FormatRaw, "":
+		return newRawReader(r, c.formatPrefix, c.formatSeparator, c.formatPostfix)
+	case FormatJSONL:
+		return &jsonlReader{r: bufio.NewReader(r)}, nil
+	}
+	return nil, fmt.Errorf("Unknown input format %q", c.format)
+}
+
+// openInput opens the input file, decompressed if required, or the
+// directory of a directory export, and the reader of its messages. The
+// returned function closes the input.
+func (c *CommandInfo) openInput(file string) (messageReader, func(), error) {
+	info, err := os.Stat(file)
+	if err == nil && info.IsDir() {
+		r, err := newDirReader(file)
+		return r, func() {}, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to open input file: %v", err)
+	}
+	in, closeDecompressor, err := decompressReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	closeInput := func() {
+		closeDecompressor()
+		f.Close()
+	}
+	r, err := c.newMessageReader(in)
+	if err != nil {
+		closeInput()
+		return nil, nil, err
+	}
+	return r, closeInput, nil
+}
+
+// rawReader reads the message bodies delimited by a separator, with
+// an optional prefix and postfix around the message list
+type rawReader struct {
+	scanner *bufio.Scanner
+	postfix []byte
+	next    []byte
+	done    bool
+}
+
+func newRawReader(r io.Reader, prefix, separator, postfix string) (*rawReader, error) {
+	br := bufio.NewReader(r)
+	if prefix != "" {
+		head := make([]byte, len(prefix))
+		if _, err := io.ReadFull(br, head); err != nil || string(head) != prefix {
+			return nil, fmt.Errorf("Input does not start with the prefix %q", prefix)
+		}
+	}
+
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	scanner.Split(splitSeparator([]byte(separator)))
+
+	rr := &rawReader{scanner: scanner, postfix: []byte(postfix)}
+	rr.advance()
+	return rr, nil
+}
+
+// advance reads the next body ahead, so the last one can be detected
+// to remove the postfix
+func (r *rawReader) advance() {
+	if r.scanner.Scan() {
+		r.next = append([]byte(nil), r.scanner.Bytes()...)
+	} else {
+		r.next = nil
+		r.done = true
+	}
+}
+
+func (r *rawReader) read() (importedMessage, error) {
+	for !r.done {
+		body := r.next
+		r.advance()
+		if r.done {
+			body = bytes.TrimSuffix(body, r.postfix)
+			// trailing separator or postfix, no message
+			if len(body) == 0 {
+				break
+			}
+		}
+		return importedMessage{msg: amqp.Publishing{Body: body}}, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return importedMessage{}, fmt.Errorf("Error reading input: %v", err)
+	}
+	return importedMessage{}, io.EOF
+}
+
+// splitSeparator splits the input in the tokens delimited by the
+// separator (the full input when the separator is empty)
+func splitSeparator(sep []byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if len(sep) > 0 {
+			if i := bytes.Index(data, sep); i >= 0 {
+				return i + len(sep), data[:i], nil
+			}
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// jsonlReader reads the message envelopes, one per line
+type jsonlReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+func (j *jsonlReader) read() (importedMessage, error) {
+	for {
+		data, err := j.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return importedMessage{}, fmt.Errorf("Error reading input: %v", err)
+		}
+		if len(data) == 0 && err == io.EOF {
+			return importedMessage{}, io.EOF
+		}
+		j.line++
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		var env envelope
+		if jsonErr := json.Unmarshal(data, &env); jsonErr != nil {
+			return importedMessage{}, fmt.Errorf("Invalid message in line %d: %v", j.line, jsonErr)
+		}
+		msg, pubErr := env.publishing()
+		if pubErr != nil {
+			return importedMessage{}, fmt.Errorf("Invalid message in line %d: %v", j.line, pubErr)
+		}
+		return importedMessage{routingKey: env.RoutingKey, msg: msg}, nil
+	}
+}
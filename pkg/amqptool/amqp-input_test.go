@@ -0,0 +1,114 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readBodies reads all the message bodies from the reader
+func readBodies(t *testing.T, r messageReader) []string {
+	var bodies []string
+	for {
+		im, err := r.read()
+		if err == io.EOF {
+			return bodies
+		}
+		if !assert.NoError(t, err) {
+			return bodies
+		}
+		bodies = append(bodies, string(im.msg.Body))
+	}
+}
+
+func TestRawReader(t *testing.T) {
+
+	cases := []struct {
+		name                       string
+		input                      string
+		prefix, separator, postfix string
+		bodies                     []string
+	}{
+		{"Separated", "1\n2\n3", "", "\n", "", []string{"1", "2", "3"}},
+		{"Trailing separator", "1\n2\n3\n", "", "\n", "", []string{"1", "2", "3"}},
+		{"Prefix and postfix", "[1,2,3]", "[", ",", "]", []string{"1", "2", "3"}},
+		{"Trailing separator and postfix", "[1,2,3,]", "[", ",", "]", []string{"1", "2", "3"}},
+		{"Multi-byte separator", "a<->b<->c", "", "<->", "", []string{"a", "b", "c"}},
+		{"No separator", "single message\n", "", "", "", []string{"single message\n"}},
+		{"Empty input", "", "", "\n", "", nil},
+		{"Only prefix and postfix", "()", "(", "-", ")", nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newRawReader(strings.NewReader(tc.input), tc.prefix, tc.separator, tc.postfix)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.bodies, readBodies(t, r))
+		})
+	}
+
+	t.Run("Error with missing prefix", func(t *testing.T) {
+		_, err := newRawReader(strings.NewReader("1,2]"), "[", ",", "]")
+		assert.Error(t, err)
+	})
+
+	t.Run("Large message", func(t *testing.T) {
+		big := strings.Repeat("x", 1024*1024)
+		r, err := newRawReader(strings.NewReader(big+"\n"+big), "", "\n", "")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{big, big}, readBodies(t, r))
+	})
+}
+
+func TestJSONLReader(t *testing.T) {
+
+	t.Run("Read envelopes", func(t *testing.T) {
+		input := `{"routing_key":"a","body":"1","body_encoding":"utf8"}
+
+{"routing_key":"b","body":"Mg==","body_encoding":"base64"}`
+		r := &jsonlReader{r: bufio.NewReader(strings.NewReader(input))}
+
+		im, err := r.read()
+		assert.NoError(t, err)
+		assert.Equal(t, "a", im.routingKey)
+		assert.Equal(t, "1", string(im.msg.Body))
+
+		im, err = r.read()
+		assert.NoError(t, err)
+		assert.Equal(t, "b", im.routingKey)
+		assert.Equal(t, "2", string(im.msg.Body))
+
+		_, err = r.read()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("Error with invalid line", func(t *testing.T) {
+		r := &jsonlReader{r: bufio.NewReader(strings.NewReader("{\"body\":\"1\"}\nnot json\n"))}
+		_, err := r.read()
+		assert.NoError(t, err)
+		_, err = r.read()
+		assert.EqualError(t, err, "Invalid message in line 2: invalid character 'o' in literal null (expecting 'u')")
+	})
+
+	t.Run("Error with unknown format", func(t *testing.T) {
+		ci := CommandInfo{format: "xml"}
+		_, err := ci.newMessageReader(strings.NewReader(""))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,119 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+)
+
+// Dialer opens a connection with the broker of the url, aborting the
+// attempt when the context is done
+type Dialer func(ctx context.Context, url string) (Connection, error)
+
+// Connection is the subset of *amqp.Connection used by the commands,
+// so the library can be mocked in tests
+type Connection interface {
+	Close() error
+	Channel() (Channel, error)
+}
+
+// Channel is the subset of *amqp.Channel used by the commands, so the
+// library can be mocked in tests
+type Channel interface {
+	Close() error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Get(queue string, autoAck bool) (amqp.Delivery, bool, error)
+	Nack(tag uint64, multiple bool, requeue bool) error
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyReturn(returns chan amqp.Return) chan amqp.Return
+}
+
+// --------------------------------------------------------------------------------
+
+// wrapper implementation for help to mock and test the amqp library
+type wrapperConn struct {
+	conn *amqp.Connection
+}
+
+func (c *wrapperConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *wrapperConn) Channel() (Channel, error) {
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return &wrapperChannel{channel: ch}, nil
+}
+
+type wrapperChannel struct {
+	channel *amqp.Channel
+}
+
+func (c *wrapperChannel) Close() error {
+	return c.channel.Close()
+}
+
+func (c *wrapperChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	return c.channel.Consume(queue, consumer, autoAck, exclusive, noLocal, noWait, args)
+}
+
+func (c *wrapperChannel) Cancel(consumer string, noWait bool) error {
+	return c.channel.Cancel(consumer, noWait)
+}
+
+func (c *wrapperChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	return c.channel.Qos(prefetchCount, prefetchSize, global)
+}
+
+func (c *wrapperChannel) QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return c.channel.QueueDeclarePassive(name, durable, autoDelete, exclusive, noWait, args)
+}
+
+func (c *wrapperChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return c.channel.QueueDeclare(name, durable, autoDelete, exclusive, noWait, args)
+}
+
+func (c *wrapperChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	return c.channel.Publish(exchange, key, mandatory, immediate, msg)
+}
+
+func (c *wrapperChannel) Get(queue string, autoAck bool) (amqp.Delivery, bool, error) {
+	return c.channel.Get(queue, autoAck)
+}
+
+func (c *wrapperChannel) Nack(tag uint64, multiple bool, requeue bool) error {
+	return c.channel.Nack(tag, multiple, requeue)
+}
+
+func (c *wrapperChannel) Confirm(noWait bool) error {
+	return c.channel.Confirm(noWait)
+}
+
+func (c *wrapperChannel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	return c.channel.NotifyPublish(confirm)
+}
+
+func (c *wrapperChannel) NotifyReturn(returns chan amqp.Return) chan amqp.Return {
+	return c.channel.NotifyReturn(returns)
+}
@@ -0,0 +1,156 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/streadway/amqp"
+)
+
+// QueueDefinition is the declaration of a queue: its durability and
+// arguments (e.g. x-message-ttl or x-dead-letter-exchange). AMQP
+// doesn't expose them, so they are read from the management API (see
+// WithManagementURL).
+type QueueDefinition struct {
+	Durable    bool
+	AutoDelete bool
+	Arguments  amqp.Table
+}
+
+// queueDefinitionJSON is the serialization of a queue definition, with
+// the typed arguments
+type queueDefinitionJSON struct {
+	Durable    bool                  `json:"durable"`
+	AutoDelete bool                  `json:"auto_delete"`
+	Arguments  map[string]typedValue `json:"arguments,omitempty"`
+}
+
+// MarshalJSON encodes the definition keeping the amqp types of the
+// arguments
+func (d QueueDefinition) MarshalJSON() ([]byte, error) {
+	args, err := encodeTable(d.Arguments)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(queueDefinitionJSON{Durable: d.Durable, AutoDelete: d.AutoDelete, Arguments: args})
+}
+
+// UnmarshalJSON decodes a definition encoded with MarshalJSON
+func (d *QueueDefinition) UnmarshalJSON(data []byte) error {
+	var def queueDefinitionJSON
+	if err := json.Unmarshal(data, &def); err != nil {
+		return err
+	}
+	*d = QueueDefinition{Durable: def.Durable, AutoDelete: def.AutoDelete}
+	if len(def.Arguments) > 0 {
+		args, err := decodeTable(def.Arguments)
+		if err != nil {
+			return err
+		}
+		d.Arguments = args
+	}
+	return nil
+}
+
+// managementQueue is the part of a queue of the management API with
+// its definition
+type managementQueue struct {
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+// queueDefinition reads the definition of the queue from the management
+// API, with the credentials and the vhost of the connection settings
+func (c *CommandInfo) queueDefinition(ctx context.Context, queue string) (QueueDefinition, error) {
+	uri, err := c.connection.uri()
+	if err != nil {
+		return QueueDefinition{}, err
+	}
+	base, err := url.Parse(strings.TrimSuffix(c.managementURL, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return QueueDefinition{}, fmt.Errorf("Invalid management URL %q", c.managementURL)
+	}
+	client := &http.Client{Timeout: connectionTimeout}
+	if base.Scheme == "https" {
+		cfg, err := newTLSConfig(c.connection.TLS)
+		if err != nil {
+			return QueueDefinition{}, err
+		}
+		client.Transport = &http.Transport{TLSClientConfig: cfg}
+	}
+
+	req, err := http.NewRequest(http.MethodGet,
+		base.String()+"/api/queues/"+url.PathEscape(uri.Vhost)+"/"+url.PathEscape(queue), nil)
+	if err != nil {
+		return QueueDefinition{}, fmt.Errorf("Invalid management URL %q", c.managementURL)
+	}
+	req.SetBasicAuth(uri.Username, uri.Password)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return QueueDefinition{}, fmt.Errorf("Failed to read the queue %q from the management API: %v", queue, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return QueueDefinition{}, fmt.Errorf("Failed to read the queue %q from the management API: %s", queue, resp.Status)
+	}
+
+	var q managementQueue
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err = dec.Decode(&q); err != nil {
+		return QueueDefinition{}, fmt.Errorf("Invalid response of the management API: %v", err)
+	}
+	def := QueueDefinition{Durable: q.Durable, AutoDelete: q.AutoDelete}
+	if len(q.Arguments) > 0 {
+		def.Arguments = amqp.Table{}
+		for name, value := range q.Arguments {
+			def.Arguments[name] = managementValue(value)
+		}
+	}
+	return def, nil
+}
+
+// managementValue converts a json value of the management API to the
+// amqp type the broker expects: integers are long, the rest keep their
+// json type
+func managementValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		table := amqp.Table{}
+		for name, field := range v {
+			table[name] = managementValue(field)
+		}
+		return table
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, field := range v {
+			list[i] = managementValue(field)
+		}
+		return list
+	}
+	return value
+}
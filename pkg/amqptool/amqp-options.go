@@ -0,0 +1,389 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"time"
+)
+
+// Option configures a CommandInfo created with NewCommandInfo
+type Option func(*CommandInfo)
+
+// WithConnection defines the broker connection settings (localhost
+// with the guest user by default)
+func WithConnection(connection ConnectionSettings) Option {
+	return func(c *CommandInfo) {
+		c.connection = connection
+	}
+}
+
+// WithDialer replaces the default dialer, e.g. to use a custom
+// transport or a mock in tests
+func WithDialer(dialer Dialer) Option {
+	return func(c *CommandInfo) {
+		c.dialer = dialer
+	}
+}
+
+// WithDestination defines the connection settings of the broker to
+// copy or move the messages to, when it is not the source one (another
+// cluster or vhost)
+func WithDestination(connection ConnectionSettings) Option {
+	return func(c *CommandInfo) {
+		c.dstConnection = &connection
+	}
+}
+
+// WithDestinationDialer replaces the default dialer of the destination
+// broker
+func WithDestinationDialer(dialer Dialer) Option {
+	return func(c *CommandInfo) {
+		c.dstDialer = dialer
+	}
+}
+
+// WithReconnect reopens the source or destination connection when it
+// is lost while copying or moving, with the number of attempts and the
+// delay before each one. The source is only reopened when the consumed
+// messages are acked (move, or export with auto ACK), as the messages
+// not acked would be delivered again.
+func WithReconnect(attempts int, delay time.Duration) Option {
+	return func(c *CommandInfo) {
+		c.reconnectAttempts = attempts
+		c.reconnectDelay = delay
+	}
+}
+
+// WithAutoACK acknowledges the consumed messages once processed,
+// removing them from the source queue (a move instead of a copy)
+func WithAutoACK(autoACK bool) Option {
+	return func(c *CommandInfo) {
+		c.autoACK = autoACK
+	}
+}
+
+// WithSnapshot processes the messages in the queue at start without
+// removing them: they are held unacked and requeued all together at
+// the end, so the queue keeps the same messages in the same order
+// (flagged as redelivered). The prefetch is the depth of the queue,
+// unless it is over the protocol limit (65535) and it is unlimited.
+// It has no effect when the messages are acked.
+func WithSnapshot(snapshot bool) Option {
+	return func(c *CommandInfo) {
+		c.snapshot = snapshot
+	}
+}
+
+// WithFilters only processes the messages matching all the filters.
+// The rest are left in the queue: they are held unacked while the
+// command runs and requeued at the end. Out of snapshot mode, at most
+// DefaultMaxHeld of them are held (see WithMaxHeld): the command fails
+// once the limit is reached, after requeuing them.
+func WithFilters(filters ...Filter) Option {
+	return func(c *CommandInfo) {
+		c.filters = append(c.filters, filters...)
+	}
+}
+
+// WithMaxHeld defines the maximum of messages not matching the filters
+// held unacked out of snapshot mode (DefaultMaxHeld by default)
+func WithMaxHeld(maxHeld int) Option {
+	return func(c *CommandInfo) {
+		c.maxHeld = maxHeld
+	}
+}
+
+// WithPrefetch defines the prefetch count of the consumer (1 by
+// default, 0 for unlimited)
+func WithPrefetch(prefetch int) Option {
+	return func(c *CommandInfo) {
+		c.prefetch = prefetch
+	}
+}
+
+// WithCount limits the number of messages to process (0, the
+// default, for no limit)
+func WithCount(count int) Option {
+	return func(c *CommandInfo) {
+		c.count = count
+	}
+}
+
+// WithUntilEmpty stops the consumption once the messages in the queue
+// at start are processed. When the messages are not acked it implies
+// WithSnapshot, as they would not be received beyond the prefetch.
+func WithUntilEmpty(untilEmpty bool) Option {
+	return func(c *CommandInfo) {
+		c.untilEmpty = untilEmpty
+	}
+}
+
+// WithIdleTimeout stops the consumption when no message arrives for
+// the given duration (0, the default, to keep waiting)
+func WithIdleTimeout(idleTimeout time.Duration) Option {
+	return func(c *CommandInfo) {
+		c.idleTimeout = idleTimeout
+	}
+}
+
+// WithFile defines the output file of the processed messages, or the
+// input file of the import (stdout by default for the output)
+func WithFile(file string) Option {
+	return func(c *CommandInfo) {
+		c.file = file
+	}
+}
+
+// WithFormat defines the format of the output and input files,
+// FormatRaw (the default) or FormatJSONL, or FormatTemplate, FormatCSV
+// and FormatTable for the output (see WithTemplate and WithColumns)
+func WithFormat(format string) Option {
+	return func(c *CommandInfo) {
+		c.format = format
+	}
+}
+
+// WithTemplate writes every processed message rendered with the
+// text/template, with the TemplateMessage data and the helpers base64,
+// json, toUpper, toLower, trim, replace, default, path, formatTime,
+// unixTime, csv, sqlString and shellQuote. The messages are separated
+// and surrounded as in the raw format (see WithRawFormat).
+func WithTemplate(text string) Option {
+	return func(c *CommandInfo) {
+		c.format = FormatTemplate
+		c.template = text
+	}
+}
+
+// WithColumns defines the columns of the CSV format (DefaultColumns
+// by default), with the fields of the filters (see Filter): the
+// message properties (message_id, timestamp, routing_key, ...),
+// headers.NAME, body and body.PATH for the fields of a JSON body, e.g.
+// body.order.lines.0.sku
+func WithColumns(columns ...string) Option {
+	return func(c *CommandInfo) {
+		c.columns = append(c.columns, columns...)
+	}
+}
+
+// WithCompression compresses the output file with CompressGzip or
+// CompressZstd, or disables it with CompressNone. By default it
+// depends on the file extension (.gz, .zst or .zstd). The imported
+// files are decompressed when they are gzip or zstd, whatever the
+// extension.
+func WithCompression(compression string) Option {
+	return func(c *CommandInfo) {
+		c.compression = compression
+	}
+}
+
+// WithSplitEvery splits the output in files of the given number of
+// messages. The files are named after the output file, numbered from
+// 1 (orders.jsonl is split in orders-00001.jsonl, orders-00002.jsonl,
+// ...), and every file is a complete output, with the prefix and the
+// postfix. The manifest (orders.manifest.json) lists the files with
+// their messages.
+func WithSplitEvery(messages int) Option {
+	return func(c *CommandInfo) {
+		c.splitEvery = messages
+	}
+}
+
+// WithSplitSize splits the output in files of the given size (before
+// compression). A file is closed when a message reaches the size, so
+// it can be a bit bigger. See WithSplitEvery.
+func WithSplitSize(bytes int64) Option {
+	return func(c *CommandInfo) {
+		c.splitSize = bytes
+	}
+}
+
+// WithSplitInterval splits the output in files covering the given
+// duration. A file is closed when a message arrives after the
+// interval, so no empty file is created while the queue is idle. See
+// WithSplitEvery.
+func WithSplitInterval(interval time.Duration) Option {
+	return func(c *CommandInfo) {
+		c.splitInterval = interval
+	}
+}
+
+// WithSplitTimestamp adds the creation time (UTC) to the names of the
+// split files, e.g. orders-20240301T103000Z-00001.jsonl
+func WithSplitTimestamp(timestamp bool) Option {
+	return func(c *CommandInfo) {
+		c.splitTimestamp = timestamp
+	}
+}
+
+// WithDirectory writes every processed message in its own file of the
+// directory, instead of the output file: the body, with the extension
+// of the content type (.json, .xml, .txt, ..., .bin when unknown), and
+// a .meta.json sidecar with the routing information, the properties
+// and the headers. The directory must be empty or not exist. The
+// format, the compression and the split options don't apply.
+// CommandImport reads such a directory back.
+func WithDirectory(dir string) Option {
+	return func(c *CommandInfo) {
+		c.dir = dir
+	}
+}
+
+// WithFileName defines the text/template of the names (without
+// extension) of the files of WithDirectory, with the TemplateMessage
+// data and helpers of WithTemplate, e.g. {{.MessageId}} or
+// {{index .Headers "x-tenant"}}-{{.Index}} (DefaultFileName by
+// default). The unsafe characters are replaced by _, and repeated
+// names, whatever their extension, get a -2, -3, ... suffix.
+// CommandImport reads the numeric names in the order of their value.
+func WithFileName(text string) Option {
+	return func(c *CommandInfo) {
+		c.fileName = text
+	}
+}
+
+// WithRawFormat defines the prefix, separator and postfix of the
+// message list in the raw format (a new line separator by default)
+func WithRawFormat(prefix, separator, postfix string) Option {
+	return func(c *CommandInfo) {
+		c.formatPrefix = prefix
+		c.formatSeparator = separator
+		c.formatPostfix = postfix
+	}
+}
+
+// WithExchange publishes the copied, moved or imported messages to
+// the destination as an exchange, with the routing key (the original
+// routing key of every message when empty)
+func WithExchange(routingKey string) Option {
+	return func(c *CommandInfo) {
+		c.toExchange = true
+		c.routingKey = routingKey
+	}
+}
+
+// WithRoutingKeyHeader takes the routing key of every message
+// published to an exchange from the header, when the message has it
+func WithRoutingKeyHeader(header string) Option {
+	return func(c *CommandInfo) {
+		c.routingKeyHeader = header
+	}
+}
+
+// WithDeathReasons only redrives the messages dead-lettered for one of
+// the reasons (rejected, expired, maxlen or delivery_limit), all of
+// them by default
+func WithDeathReasons(reasons ...string) Option {
+	return func(c *CommandInfo) {
+		c.deathReasons = append(c.deathReasons, reasons...)
+	}
+}
+
+// WithMaxDeaths only redrives the messages dead-lettered at most the
+// given times, counting all the x-death entries (0, the default, for
+// no limit)
+func WithMaxDeaths(maxDeaths int) Option {
+	return func(c *CommandInfo) {
+		c.maxDeaths = maxDeaths
+	}
+}
+
+// WithStripDeaths removes the dead-lettering history (x-death and the
+// x-first-death and x-last-death headers) from the redriven messages.
+// By default it is preserved, so the broker keeps counting the deaths.
+func WithStripDeaths(strip bool) Option {
+	return func(c *CommandInfo) {
+		c.stripDeaths = strip
+	}
+}
+
+// WithRedriveToQueue redrives the messages straight to the queue they
+// died from, instead of the exchange and routing key they were
+// published with (that could route them to other queues too)
+func WithRedriveToQueue(toQueue bool) Option {
+	return func(c *CommandInfo) {
+		c.redriveToQueue = toQueue
+	}
+}
+
+// WithSetHeader sets the header of the copied, moved, redriven and
+// published messages to the value (see ParseHeader)
+func WithSetHeader(name string, value interface{}) Option {
+	return func(c *CommandInfo) {
+		c.headerRules = append(c.headerRules, headerRule{op: headerSet, name: name, value: value})
+	}
+}
+
+// WithDeleteHeader removes the header from the copied, moved and
+// redriven messages
+func WithDeleteHeader(name string) Option {
+	return func(c *CommandInfo) {
+		c.headerRules = append(c.headerRules, headerRule{op: headerDelete, name: name})
+	}
+}
+
+// WithRenameHeader renames the header of the copied, moved and
+// redriven messages, when they have it. The header rules are applied
+// in the order of the options.
+func WithRenameHeader(from, to string) Option {
+	return func(c *CommandInfo) {
+		c.headerRules = append(c.headerRules, headerRule{op: headerRename, name: from, to: to})
+	}
+}
+
+// WithProperty overrides a property of the copied, moved, redriven and
+// published messages. The name is the one of the filters (content_type,
+// delivery_mode, priority, expiration, app_id, timestamp, ...) and the
+// value is validated when the command runs (see ValidateProperty).
+func WithProperty(name, value string) Option {
+	return func(c *CommandInfo) {
+		c.properties = append(c.properties, property{name: name, value: value})
+	}
+}
+
+// WithProvenance adds to the copied, moved and redriven messages the
+// headers with their source queue, exchange and routing key and the
+// time they were moved (HeaderSourceQueue, HeaderSourceExchange,
+// HeaderSourceRoutingKey and HeaderMovedAt)
+func WithProvenance(provenance bool) Option {
+	return func(c *CommandInfo) {
+		c.provenance = provenance
+	}
+}
+
+// WithRepeat publishes the message of CommandPublish the given times
+// (once by default)
+func WithRepeat(repeat int) Option {
+	return func(c *CommandInfo) {
+		c.repeat = repeat
+	}
+}
+
+// WithRate limits the messages published per second by CommandPublish
+// (0 for no limit)
+func WithRate(rate float64) Option {
+	return func(c *CommandInfo) {
+		c.rate = rate
+	}
+}
+
+// WithManagementURL defines the URL of the management API of the
+// broker, e.g. http://localhost:15672, to read the definitions of the
+// backed up queues (see CommandBackup), with the credentials and the
+// vhost of the connection settings
+func WithManagementURL(url string) Option {
+	return func(c *CommandInfo) {
+		c.managementURL = url
+	}
+}
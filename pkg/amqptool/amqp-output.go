@@ -0,0 +1,263 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Output formats for the processed messages
+const (
+	FormatRaw      = "raw"
+	FormatJSONL    = "jsonl"
+	FormatTemplate = "template"
+	FormatCSV      = "csv"
+	FormatTable    = "table"
+)
+
+// messageWriter serializes the processed messages in the output
+type messageWriter interface {
+	begin() error
+	write(msg amqp.Delivery) error
+	end() error
+}
+
+// newMessageWriter creates the writer for the configured format, with
+// the index of its first message in the whole output
+func (c *CommandInfo) newMessageWriter(w io.Writer, index int) (messageWriter, error) {
+	switch c.format {
+	case FormatRaw, "":
+		return &rawWriter{w: w, prefix: c.formatPrefix, separator: c.formatSeparator, postfix: c.formatPostfix}, nil
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		return &jsonlWriter{enc: enc}, nil
+	case FormatCSV:
+		return newCSVWriter(w, c.columns)
+	case FormatTable:
+		t := newTableWriter(w)
+		t.index = index
+		return t, nil
+	case FormatTemplate:
+		tmpl, err := parseTemplate(c.template)
+		if err != nil {
+			return nil, err
+		}
+		return &rawWriter{w: w, prefix: c.formatPrefix, separator: c.formatSeparator, postfix: c.formatPostfix, tmpl: tmpl, index: index}, nil
+	}
+	return nil, fmt.Errorf("Unknown output format %q", c.format)
+}
+
+// openOutput creates the output file (stdout if no file is defined),
+// compressed if required, and the writer for the configured format,
+// already started. The returned function finishes the output and
+// closes the file. With a split option the output is a sequence of
+// files (see WithSplitEvery, WithSplitSize and WithSplitInterval), and
+// with a directory a file per message (see WithDirectory).
+func (c *CommandInfo) openOutput() (messageWriter, func() error, error) {
+	if c.dir != "" {
+		w, err := c.newDirWriter()
+		if err == nil {
+			err = w.begin()
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return w, w.end, nil
+	}
+	compression, err := c.outputCompression()
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.splitEvery > 0 || c.splitSize > 0 || c.splitInterval > 0 {
+		return c.openSplitOutput(compression)
+	}
+	part, err := c.openPart(c.file, compression, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return part.w, part.close, nil
+}
+
+// outputPart is an output file with the writer of its messages
+type outputPart struct {
+	file     *os.File
+	cw       io.WriteCloser
+	size     *countingWriter
+	w        messageWriter
+	messages int
+	created  time.Time
+}
+
+// countingWriter counts the bytes written
+type countingWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// openPart creates the file (stdout if empty), compressed if
+// required, and the writer for the configured format, already started,
+// with the index of its first message in the whole output
+func (c *CommandInfo) openPart(file, compression string, index int) (*outputPart, error) {
+	p := &outputPart{file: os.Stdout, created: time.Now()}
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create output file: %v", err)
+		}
+		p.file = f
+	}
+
+	var err error
+	p.cw, err = compressWriter(p.file, compression)
+	if err != nil {
+		p.closeFile()
+		return nil, err
+	}
+	p.size = &countingWriter{w: p.cw}
+	p.w, err = c.newMessageWriter(p.size, index)
+	if err == nil {
+		err = p.w.begin()
+	}
+	if err != nil {
+		p.cw.Close()
+		p.closeFile()
+		return nil, err
+	}
+	return p, nil
+}
+
+// write writes a message in the part
+func (p *outputPart) write(msg amqp.Delivery) error {
+	err := p.w.write(msg)
+	if err == nil {
+		p.messages++
+	}
+	return err
+}
+
+// close finishes the output and closes the file
+func (p *outputPart) close() error {
+	err := p.w.end()
+	if err != nil {
+		p.cw.Close()
+		p.closeFile()
+		return fmt.Errorf("Error writing in file: %v", err)
+	}
+	err = p.cw.Close()
+	if err != nil {
+		p.closeFile()
+		return fmt.Errorf("Error compressing the output: %v", err)
+	}
+	err = p.closeFile()
+	if err != nil {
+		return fmt.Errorf("Error closing file: %v", err)
+	}
+	return nil
+}
+
+func (p *outputPart) closeFile() error {
+	if p.file == os.Stdout {
+		return nil
+	}
+	return p.file.Close()
+}
+
+// rawWriter writes the message bodies, or the messages rendered with
+// the template, with a prefix, separator and postfix. The separator is
+// written before every message but the first one, so the output is
+// consistent whenever it is finished.
+type rawWriter struct {
+	w         io.Writer
+	prefix    string
+	separator string
+	postfix   string
+	tmpl      *template.Template
+	index     int
+	written   int
+	buf       bytes.Buffer
+}
+
+func (r *rawWriter) begin() error {
+	_, err := io.WriteString(r.w, r.prefix)
+	return err
+}
+
+func (r *rawWriter) write(msg amqp.Delivery) error {
+	content := msg.Body
+	if r.tmpl != nil {
+		r.buf.Reset()
+		err := r.tmpl.Execute(&r.buf, newTemplateMessage(r.index, msg))
+		if err != nil {
+			return fmt.Errorf("Error rendering the template: %v", err)
+		}
+		content = r.buf.Bytes()
+	}
+	if r.written > 0 {
+		_, err := io.WriteString(r.w, r.separator)
+		if err != nil {
+			return fmt.Errorf("Error writing in file: %v", err)
+		}
+	}
+	r.written++
+	r.index++
+	_, err := r.w.Write(content)
+	if err != nil {
+		return fmt.Errorf("Error writing message content in file: %v", err)
+	}
+	return nil
+}
+
+func (r *rawWriter) end() error {
+	_, err := io.WriteString(r.w, r.postfix)
+	return err
+}
+
+// jsonlWriter writes every message as a JSON envelope per line
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) begin() error {
+	return nil
+}
+
+func (j *jsonlWriter) write(msg amqp.Delivery) error {
+	env, err := newEnvelope(msg)
+	if err != nil {
+		return fmt.Errorf("Error encoding message: %v", err)
+	}
+	if err = j.enc.Encode(env); err != nil {
+		return fmt.Errorf("Error writing message content in file: %v", err)
+	}
+	return nil
+}
+
+func (j *jsonlWriter) end() error {
+	return nil
+}
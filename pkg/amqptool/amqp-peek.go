@@ -0,0 +1,92 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"context"
+	"fmt"
+)
+
+// CommandPeek writes the first messages of a queue (WithCount of them,
+// all if 0) in the output, fetching them one by one with basic.get and
+// requeuing all of them at the end, so the queue is not consumed. The
+// requeued messages keep their position but they are marked as
+// redelivered. The table format (see FormatTable) is intended for it.
+func (c *CommandInfo) CommandPeek(queue string) error {
+	return c.CommandPeekContext(context.Background(), queue)
+}
+
+// CommandPeekContext writes the first messages of a queue until the
+// context is done.
+func (c *CommandInfo) CommandPeekContext(ctx context.Context, queue string) (err error) {
+	c.processed = 0
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("Failed to open a channel: %v", err)
+	}
+	defer ch.Close()
+
+	w, closeOutput, err := c.openOutput()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := closeOutput(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	// the last delivery fetched, to requeue it and all the previous
+	// ones at the end
+	var last uint64
+	defer func() {
+		if last == 0 {
+			return
+		}
+		if nackErr := ch.Nack(last, true, true); nackErr != nil && err == nil {
+			err = fmt.Errorf("Error requeuing the peeked messages: %v", nackErr)
+		}
+	}()
+
+	interrupted := c.interrupted()
+	for c.count == 0 || c.processed < c.count {
+		select {
+		case <-interrupted:
+			return nil
+		case <-ctx.Done():
+			return c.canceled(ctx)
+		default:
+		}
+
+		msg, ok, err := ch.Get(queue, false)
+		if err != nil {
+			return fmt.Errorf("Failed to get a message: %v", err)
+		}
+		if !ok {
+			return nil
+		}
+		last = msg.DeliveryTag
+		if err = w.write(msg); err != nil {
+			return err
+		}
+		c.processed++
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandPeek(t *testing.T) {
+	t.Run("Peek the first messages as a table", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "peek.txt")
+		tconn := testConnection{}
+		amcmd := newTestCommand(&tconn, WithFile(file), WithFormat(FormatTable), WithCount(3))
+		err := amcmd.CommandPeek("test")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, amcmd.Processed())
+		assert.Equal(t, []uint64{3}, tconn.channelNacks, "all requeued at once")
+		assert.Equal(t, 0, tconn.ackCount)
+
+		data, err := ioutil.ReadFile(file)
+		assert.NoError(t, err)
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		assert.Len(t, lines, 4)
+		assert.True(t, strings.HasPrefix(lines[0], "INDEX"))
+		assert.Contains(t, lines[3], string(testL5[2]))
+	})
+
+	t.Run("Peek the whole queue as jsonl", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "peek.txt")
+		tconn := testConnection{}
+		amcmd := newTestCommand(&tconn, WithFile(file), WithFormat(FormatJSONL))
+		err := amcmd.CommandPeek("test")
+		assert.NoError(t, err)
+		assert.Equal(t, len(testL5), amcmd.Processed())
+		assert.Equal(t, []uint64{uint64(len(testL5))}, tconn.channelNacks)
+
+		data, err := ioutil.ReadFile(file)
+		assert.NoError(t, err)
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		assert.Len(t, lines, len(testL5))
+		var env envelope
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &env))
+		assert.Equal(t, string(testL5[0]), env.Body)
+	})
+
+	t.Run("Peek an empty queue", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "peek.txt")
+		tconn := testConnection{deliveries: []amqp.Delivery{}}
+		amcmd := newTestCommand(&tconn, WithFile(file), WithFormat(FormatTable))
+		err := amcmd.CommandPeek("test")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, amcmd.Processed())
+		assert.Empty(t, tconn.channelNacks)
+	})
+
+	t.Run("Error peeking", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "peek.txt")
+		assert.Error(t, newTestCommand(&testConnection{errorChannelGet: true}, WithFile(file)).CommandPeek("test"))
+		assert.Error(t, newTestCommand(&testConnection{errorChannelNack: true}, WithFile(file)).CommandPeek("test"))
+		assert.Error(t, newTestCommand(&testConnection{errorChannel: true}, WithFile(file)).CommandPeek("test"))
+		assert.Error(t, newTestCommand(&testConnection{}, WithFile(file), WithFormat("unknown")).CommandPeek("test"))
+	})
+}
@@ -0,0 +1,95 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// CommandPublish publishes a message to the exchange (the default
+// exchange if empty) with the routing key, with the header rules and
+// the property overrides applied over it (see WithSetHeader and
+// WithProperty). The message is published WithRepeat times, at most
+// WithRate messages per second.
+func (c *CommandInfo) CommandPublish(exchange, routingKey string, msg amqp.Publishing) error {
+	return c.CommandPublishContext(context.Background(), exchange, routingKey, msg)
+}
+
+// CommandPublishContext publishes a message until the repetitions are
+// done or the context is done.
+func (c *CommandInfo) CommandPublishContext(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	c.processed = 0
+	rewrite, err := c.rewriter("")
+	if err != nil {
+		return err
+	}
+	rewrite(&msg, amqp.Delivery{Exchange: exchange, RoutingKey: routingKey})
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("Failed to open a channel: %v", err)
+	}
+	defer ch.Close()
+
+	repeat := c.repeat
+	if repeat <= 0 {
+		repeat = 1
+	}
+	var throttle <-chan time.Time
+	if c.rate > 0 {
+		// a rate above one message per nanosecond is not throttled
+		if interval := time.Duration(float64(time.Second) / c.rate); interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			throttle = ticker.C
+		}
+	}
+
+	interrupted := c.interrupted()
+	for c.processed < repeat {
+		if throttle != nil && c.processed > 0 {
+			select {
+			case <-throttle:
+			case <-interrupted:
+				return nil
+			case <-ctx.Done():
+				return c.canceled(ctx)
+			}
+		}
+		select {
+		case <-interrupted:
+			return nil
+		case <-ctx.Done():
+			return c.canceled(ctx)
+		default:
+		}
+
+		err = ch.Publish(exchange, routingKey, false, false, msg)
+		if err != nil {
+			return fmt.Errorf("Error on message publishing: %v", err)
+		}
+		c.processed++
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandPublish(t *testing.T) {
+	t.Run("Publish a message with headers and properties", func(t *testing.T) {
+		tconn := testConnection{}
+		headers := amqp.Table{"x-tenant": "acme"}
+		amcmd := newTestCommand(&tconn, WithSetHeader("x-retries", int32(2)), WithProperty("priority", "5"))
+		assert.NoError(t, amcmd.CommandPublish("orders", "order.created",
+			amqp.Publishing{ContentType: "application/json", Headers: headers, Body: []byte(`{"id":1}`)}))
+		assert.Equal(t, 1, amcmd.Processed())
+		assert.Equal(t, []string{"orders/order.created"}, tconn.routes)
+		msg := tconn.published[0]
+		assert.Equal(t, amqp.Table{"x-tenant": "acme", "x-retries": int32(2)}, msg.Headers)
+		assert.Equal(t, amqp.Table{"x-tenant": "acme"}, headers, "headers not modified")
+		assert.Equal(t, uint8(5), msg.Priority)
+		assert.Equal(t, "application/json", msg.ContentType)
+		assert.Equal(t, []byte(`{"id":1}`), msg.Body)
+	})
+
+	t.Run("Publish a burst at a rate", func(t *testing.T) {
+		tconn := testConnection{}
+		amcmd := newTestCommand(&tconn, WithRepeat(3), WithRate(50))
+		start := time.Now()
+		assert.NoError(t, amcmd.CommandPublish("", "orders", amqp.Publishing{Body: []byte("x")}))
+		assert.True(t, time.Since(start) >= 40*time.Millisecond)
+		assert.Equal(t, 3, amcmd.Processed())
+		assert.Equal(t, []string{"/orders", "/orders", "/orders"}, tconn.routes)
+	})
+
+	t.Run("Publish a burst above a message per nanosecond", func(t *testing.T) {
+		tconn := testConnection{}
+		amcmd := newTestCommand(&tconn, WithRepeat(3), WithRate(2e9))
+		assert.NoError(t, amcmd.CommandPublish("", "orders", amqp.Publishing{Body: []byte("x")}))
+		assert.Equal(t, 3, amcmd.Processed())
+	})
+
+	t.Run("Cancel a burst", func(t *testing.T) {
+		tconn := testConnection{}
+		amcmd := newTestCommand(&tconn, WithRepeat(10), WithRate(1))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := amcmd.CommandPublishContext(ctx, "", "orders", amqp.Publishing{Body: []byte("x")})
+		cerr, ok := err.(*CanceledError)
+		assert.True(t, ok)
+		assert.Equal(t, 1, cerr.Processed)
+		assert.Len(t, tconn.published, 1)
+	})
+
+	t.Run("Error publishing", func(t *testing.T) {
+		msg := amqp.Publishing{Body: []byte("x")}
+		assert.Error(t, newTestCommand(&testConnection{}, WithProperty("priority", "high")).CommandPublish("", "orders", msg))
+		assert.Error(t, newTestCommand(&testConnection{errorChannel: true}).CommandPublish("", "orders", msg))
+		assert.Error(t, newTestCommand(&testConnection{errorChannelPublish: true}).CommandPublish("", "orders", msg))
+	})
+}
@@ -0,0 +1,134 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"context"
+	"strings"
+
+	"github.com/streadway/amqp"
+)
+
+// Death reasons of the x-death header
+const (
+	DeathRejected      = "rejected"
+	DeathExpired       = "expired"
+	DeathMaxLen        = "maxlen"
+	DeathDeliveryLimit = "delivery_limit"
+)
+
+// death is an entry of the x-death header, added (or updated) by the
+// broker every time a message is dead-lettered from a queue. The
+// latest death is the first entry.
+type death struct {
+	count       int
+	reason      string
+	queue       string
+	exchange    string
+	routingKeys []string
+}
+
+// deaths returns the entries of the x-death header, if any
+func deaths(headers amqp.Table) []death {
+	entries, _ := headers["x-death"].([]interface{})
+	result := make([]death, 0, len(entries))
+	for _, entry := range entries {
+		table, ok := entry.(amqp.Table)
+		if !ok {
+			continue
+		}
+		d := death{}
+		if count, ok := headerValue(table["count"]).(float64); ok {
+			d.count = int(count)
+		}
+		d.reason, _ = headerValue(table["reason"]).(string)
+		d.queue, _ = headerValue(table["queue"]).(string)
+		d.exchange, _ = headerValue(table["exchange"]).(string)
+		keys, _ := table["routing-keys"].([]interface{})
+		for _, key := range keys {
+			if k, ok := headerValue(key).(string); ok {
+				d.routingKeys = append(d.routingKeys, k)
+			}
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+// redrivable reports if the message has a known origin and its death
+// matches the reasons and the maximum deaths
+func (c *CommandInfo) redrivable(msg amqp.Delivery) bool {
+	history := deaths(msg.Headers)
+	if len(history) == 0 || history[0].queue == "" {
+		return false
+	}
+	if len(c.deathReasons) > 0 {
+		found := false
+		for _, reason := range c.deathReasons {
+			found = found || reason == history[0].reason
+		}
+		if !found {
+			return false
+		}
+	}
+	if c.maxDeaths > 0 {
+		total := 0
+		for _, d := range history {
+			total += d.count
+		}
+		if total > c.maxDeaths {
+			return false
+		}
+	}
+	return true
+}
+
+// redriveTarget returns the exchange, routing key and headers to
+// publish a dead-lettered message back to its origin
+func (c *CommandInfo) redriveTarget(msg amqp.Delivery) (string, string, amqp.Table) {
+	latest := deaths(msg.Headers)[0]
+	headers := msg.Headers
+	if c.stripDeaths {
+		headers = amqp.Table{}
+		for k, v := range msg.Headers {
+			if k != "x-death" && !strings.HasPrefix(k, "x-first-death-") && !strings.HasPrefix(k, "x-last-death-") {
+				headers[k] = v
+			}
+		}
+	}
+	if c.redriveToQueue {
+		return "", latest.queue, headers
+	}
+	if len(latest.routingKeys) == 0 {
+		return latest.exchange, msg.RoutingKey, headers
+	}
+	return latest.exchange, latest.routingKeys[0], headers
+}
+
+// CommandRedrive publishes the messages of a dead-letter queue back to
+// where they died from, following their x-death header: the exchange
+// and routing key they were published with, or the queue (see
+// WithRedriveToQueue). The messages without x-death, or not matching
+// WithDeathReasons, WithMaxDeaths or the filters, are left in the
+// dead-letter queue. As with CommandCopyMoveToQueue, the messages are
+// only removed from the dead-letter queue with WithAutoACK.
+func (c *CommandInfo) CommandRedrive(queue string) error {
+	return c.CommandRedriveContext(context.Background(), queue)
+}
+
+// CommandRedriveContext redrives the messages of a dead-letter queue
+// until the context is done.
+func (c *CommandInfo) CommandRedriveContext(ctx context.Context, queue string) error {
+	return c.shovel(ctx, queue, c.redrivable, c.redriveTarget)
+}
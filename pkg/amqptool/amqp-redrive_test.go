@@ -0,0 +1,138 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDeath(queue, reason, exchange, key string, count int64) amqp.Table {
+	return amqp.Table{
+		"count":        count,
+		"reason":       reason,
+		"queue":        queue,
+		"time":         time.Now(),
+		"exchange":     exchange,
+		"routing-keys": []interface{}{key},
+	}
+}
+
+func testDeadLetter(tag uint64, body string, entries ...amqp.Table) amqp.Delivery {
+	headers := amqp.Table{"x-tenant": "acme"}
+	if len(entries) > 0 {
+		history := []interface{}{}
+		for _, e := range entries {
+			history = append(history, e)
+		}
+		headers["x-death"] = history
+		headers["x-first-death-queue"] = entries[len(entries)-1]["queue"]
+		headers["x-last-death-queue"] = entries[0]["queue"]
+	}
+	return amqp.Delivery{DeliveryTag: tag, RoutingKey: "dlq", Headers: headers, Body: []byte(body)}
+}
+
+func TestDeaths(t *testing.T) {
+	assert.Empty(t, deaths(nil))
+	assert.Empty(t, deaths(amqp.Table{"x-death": "invalid"}))
+	assert.Equal(t, []death{
+		{count: 2, reason: DeathRejected, queue: "orders", exchange: "shop", routingKeys: []string{"order.created"}},
+		{count: 1, reason: DeathExpired, queue: "delayed", exchange: "", routingKeys: []string{"delayed"}},
+	}, deaths(amqp.Table{"x-death": []interface{}{
+		testDeath("orders", DeathRejected, "shop", "order.created", 2),
+		testDeath("delayed", DeathExpired, "", "delayed", 1),
+		"invalid",
+	}}))
+}
+
+func TestCommandRedrive(t *testing.T) {
+	deliveries := []amqp.Delivery{
+		testDeadLetter(1, "1", testDeath("orders", DeathRejected, "shop", "order.created", 1)),
+		testDeadLetter(2, "2"),
+		testDeadLetter(3, "3", testDeath("orders", DeathExpired, "shop", "order.paid", 1)),
+		testDeadLetter(4, "4", testDeath("orders", DeathRejected, "shop", "order.created", 3),
+			testDeath("delayed", DeathExpired, "", "delayed", 1)),
+		testDeadLetter(5, "5", testDeath("invoices", DeathMaxLen, "", "invoices", 1)),
+	}
+
+	t.Run("Redrive to the original exchange", func(t *testing.T) {
+		tconn := testConnection{deliveries: deliveries}
+		amcmd := newTestCommand(&tconn, WithAutoACK(true), WithUntilEmpty(true), WithFile(os.DevNull))
+		assert.NoError(t, amcmd.CommandRedrive("dlq"))
+		assert.Equal(t, 4, amcmd.Processed())
+		assert.Equal(t, []string{"1", "3", "4", "5"}, tconn.dataResult)
+		assert.Equal(t, []string{"shop/order.created", "shop/order.paid", "shop/order.created", "/invoices"}, tconn.routes)
+		assert.Equal(t, 4, tconn.ackCount)
+		assert.Equal(t, 1, tconn.multipleNackCount) // without x-death
+		assert.Contains(t, tconn.published[0].Headers, "x-death")
+		assert.Contains(t, tconn.published[0].Headers, "x-first-death-queue")
+	})
+
+	t.Run("Redrive to the original queue", func(t *testing.T) {
+		tconn := testConnection{deliveries: deliveries}
+		amcmd := newTestCommand(&tconn, WithAutoACK(true), WithUntilEmpty(true), WithFile(os.DevNull),
+			WithRedriveToQueue(true))
+		assert.NoError(t, amcmd.CommandRedrive("dlq"))
+		assert.Equal(t, []string{"/orders", "/orders", "/orders", "/invoices"}, tconn.routes)
+	})
+
+	t.Run("Redrive by reason", func(t *testing.T) {
+		tconn := testConnection{deliveries: deliveries}
+		amcmd := newTestCommand(&tconn, WithAutoACK(true), WithUntilEmpty(true), WithFile(os.DevNull),
+			WithDeathReasons(DeathExpired, DeathMaxLen))
+		assert.NoError(t, amcmd.CommandRedrive("dlq"))
+		assert.Equal(t, []string{"3", "5"}, tconn.dataResult)
+		assert.Equal(t, 2, tconn.ackCount)
+	})
+
+	t.Run("Redrive with maximum deaths", func(t *testing.T) {
+		tconn := testConnection{deliveries: deliveries}
+		amcmd := newTestCommand(&tconn, WithAutoACK(true), WithUntilEmpty(true), WithFile(os.DevNull),
+			WithMaxDeaths(3))
+		assert.NoError(t, amcmd.CommandRedrive("dlq"))
+		assert.Equal(t, []string{"1", "3", "5"}, tconn.dataResult)
+	})
+
+	t.Run("Redrive with filters", func(t *testing.T) {
+		filter, err := ParseFilter("routing_key=dlq")
+		assert.NoError(t, err)
+		other, err := ParseFilter("body!=1")
+		assert.NoError(t, err)
+		tconn := testConnection{deliveries: deliveries}
+		amcmd := newTestCommand(&tconn, WithAutoACK(true), WithUntilEmpty(true), WithFile(os.DevNull),
+			WithFilters(filter, other))
+		assert.NoError(t, amcmd.CommandRedrive("dlq"))
+		assert.Equal(t, []string{"3", "4", "5"}, tconn.dataResult)
+	})
+
+	t.Run("Redrive stripping the deaths", func(t *testing.T) {
+		tconn := testConnection{deliveries: deliveries}
+		amcmd := newTestCommand(&tconn, WithAutoACK(true), WithUntilEmpty(true), WithFile(os.DevNull),
+			WithStripDeaths(true), WithCount(1))
+		assert.NoError(t, amcmd.CommandRedrive("dlq"))
+		assert.Equal(t, amqp.Table{"x-tenant": "acme"}, tconn.published[0].Headers)
+		assert.Contains(t, deliveries[0].Headers, "x-death") // not modified
+	})
+
+	t.Run("Error publishing", func(t *testing.T) {
+		tconn := testConnection{deliveries: deliveries, errorChannelPublish: true}
+		amcmd := newTestCommand(&tconn, WithAutoACK(true), WithUntilEmpty(true), WithFile(os.DevNull))
+		assert.Error(t, amcmd.CommandRedrive("dlq"))
+		assert.Equal(t, 0, tconn.ackCount)
+	})
+}
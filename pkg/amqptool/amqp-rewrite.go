@@ -0,0 +1,215 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Provenance headers added to the copied, moved and redriven messages
+// (see WithProvenance)
+const (
+	HeaderSourceQueue      = "x-amqp-go-tool-source-queue"
+	HeaderSourceExchange   = "x-amqp-go-tool-source-exchange"
+	HeaderSourceRoutingKey = "x-amqp-go-tool-source-routing-key"
+	HeaderMovedAt          = "x-amqp-go-tool-moved-at"
+)
+
+const (
+	headerSet = iota
+	headerDelete
+	headerRename
+)
+
+// headerRule sets, deletes or renames a header
+type headerRule struct {
+	op    int
+	name  string
+	to    string
+	value interface{}
+}
+
+// property is the override of a message property
+type property struct {
+	name  string
+	value string
+}
+
+// apply runs the rule over the headers
+func (r headerRule) apply(headers amqp.Table) {
+	switch r.op {
+	case headerSet:
+		headers[r.name] = r.value
+	case headerDelete:
+		delete(headers, r.name)
+	case headerRename:
+		if v, ok := headers[r.name]; ok {
+			delete(headers, r.name)
+			headers[r.to] = v
+		}
+	}
+}
+
+// ParseHeader parses a header definition name=value, or
+// name:type=value with the type of the value: string (the default),
+// bool, byte, int16, int32, int64, float32, float64, timestamp (RFC
+// 3339 or a date) or void (no value). A name with colons needs the
+// type, e.g. urn:id:string=1.
+func ParseHeader(expr string) (string, interface{}, error) {
+	i := strings.Index(expr, "=")
+	if i <= 0 {
+		return "", nil, fmt.Errorf("Invalid header %q: expected name=value", expr)
+	}
+	name, kind, text := expr[:i], "string", expr[i+1:]
+	if j := strings.LastIndex(name, ":"); j > 0 {
+		name, kind = name[:j], name[j+1:]
+	}
+
+	var value interface{}
+	var err error
+	switch kind {
+	case "string":
+		value = text
+	case "void":
+		value = nil
+	case "bool":
+		value, err = strconv.ParseBool(text)
+	case "byte":
+		var v uint64
+		v, err = strconv.ParseUint(text, 10, 8)
+		value = byte(v)
+	case "int16":
+		var v int64
+		v, err = strconv.ParseInt(text, 10, 16)
+		value = int16(v)
+	case "int32":
+		var v int64
+		v, err = strconv.ParseInt(text, 10, 32)
+		value = int32(v)
+	case "int64":
+		value, err = strconv.ParseInt(text, 10, 64)
+	case "float32":
+		var v float64
+		v, err = strconv.ParseFloat(text, 32)
+		value = float32(v)
+	case "float64":
+		value, err = strconv.ParseFloat(text, 64)
+	case "timestamp":
+		t, ok := parseTime(text)
+		if !ok {
+			err = fmt.Errorf("expected RFC 3339 time or date")
+		}
+		value = t
+	default:
+		return "", nil, fmt.Errorf("Invalid header %q: unknown type %q", expr, kind)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("Invalid header %q: %v", expr, err)
+	}
+	return name, value, nil
+}
+
+// propertySetter returns the function overriding the property of a
+// message with the value
+func propertySetter(name, value string) (func(*amqp.Publishing), error) {
+	switch name {
+	case "content_type":
+		return func(p *amqp.Publishing) { p.ContentType = value }, nil
+	case "content_encoding":
+		return func(p *amqp.Publishing) { p.ContentEncoding = value }, nil
+	case "correlation_id":
+		return func(p *amqp.Publishing) { p.CorrelationId = value }, nil
+	case "reply_to":
+		return func(p *amqp.Publishing) { p.ReplyTo = value }, nil
+	case "expiration":
+		// the broker closes the channel with any other expiration
+		if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+			return nil, fmt.Errorf("Invalid expiration %q: expected a non-negative number of milliseconds", value)
+		}
+		return func(p *amqp.Publishing) { p.Expiration = value }, nil
+	case "message_id":
+		return func(p *amqp.Publishing) { p.MessageId = value }, nil
+	case "type":
+		return func(p *amqp.Publishing) { p.Type = value }, nil
+	case "user_id":
+		return func(p *amqp.Publishing) { p.UserId = value }, nil
+	case "app_id":
+		return func(p *amqp.Publishing) { p.AppId = value }, nil
+	case "delivery_mode", "priority":
+		n, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s %q: %v", name, value, err)
+		}
+		if name == "priority" {
+			return func(p *amqp.Publishing) { p.Priority = uint8(n) }, nil
+		}
+		return func(p *amqp.Publishing) { p.DeliveryMode = uint8(n) }, nil
+	case "timestamp":
+		t, ok := parseTime(value)
+		if !ok {
+			return nil, fmt.Errorf("Invalid timestamp %q: expected RFC 3339 time or date", value)
+		}
+		return func(p *amqp.Publishing) { p.Timestamp = t }, nil
+	}
+	return nil, fmt.Errorf("Unknown message property %q", name)
+}
+
+// ValidateProperty checks the value of a message property of
+// WithProperty, that is otherwise only validated when the command runs
+func ValidateProperty(name, value string) error {
+	_, err := propertySetter(name, value)
+	return err
+}
+
+// rewriter returns the function applying the header rules, the
+// property overrides and the provenance headers to the messages
+// published from the source queue. The headers of the delivery are
+// not modified.
+func (c *CommandInfo) rewriter(queue string) (func(*amqp.Publishing, amqp.Delivery), error) {
+	setters := make([]func(*amqp.Publishing), 0, len(c.properties))
+	for _, p := range c.properties {
+		set, err := propertySetter(p.name, p.value)
+		if err != nil {
+			return nil, err
+		}
+		setters = append(setters, set)
+	}
+
+	return func(pub *amqp.Publishing, msg amqp.Delivery) {
+		if len(c.headerRules) > 0 || c.provenance {
+			headers := amqp.Table{}
+			for k, v := range pub.Headers {
+				headers[k] = v
+			}
+			for _, rule := range c.headerRules {
+				rule.apply(headers)
+			}
+			if c.provenance {
+				headers[HeaderSourceQueue] = queue
+				headers[HeaderSourceExchange] = msg.Exchange
+				headers[HeaderSourceRoutingKey] = msg.RoutingKey
+				headers[HeaderMovedAt] = time.Now().UTC().Truncate(time.Second)
+			}
+			pub.Headers = headers
+		}
+		for _, set := range setters {
+			set(pub)
+		}
+	}, nil
+}
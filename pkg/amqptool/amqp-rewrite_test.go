@@ -0,0 +1,152 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHeader(t *testing.T) {
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expr  string
+		name  string
+		value interface{}
+	}{
+		{"x-tenant=acme", "x-tenant", "acme"},
+		{"x-empty=", "x-empty", ""},
+		{"x-url=http://host/?a=b", "x-url", "http://host/?a=b"},
+		{"x-tenant:string=acme", "x-tenant", "acme"},
+		{"x-replayed:bool=true", "x-replayed", true},
+		{"x-level:byte=7", "x-level", byte(7)},
+		{"x-retries:int16=3", "x-retries", int16(3)},
+		{"x-retries:int32=-3", "x-retries", int32(-3)},
+		{"x-retries:int64=3", "x-retries", int64(3)},
+		{"x-ratio:float32=0.5", "x-ratio", float32(0.5)},
+		{"x-ratio:float64=0.25", "x-ratio", 0.25},
+		{"x-since:timestamp=2024-03-01", "x-since", date},
+		{"x-none:void=", "x-none", nil},
+		{"urn:x:id:string=1", "urn:x:id", "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			name, value, err := ParseHeader(tt.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.value, value)
+		})
+	}
+
+	for _, expr := range []string{"", "=acme", "x-tenant", "x:map=1", "x:int16=70000", "x:bool=maybe", "x:timestamp=today"} {
+		t.Run("Error "+expr, func(t *testing.T) {
+			_, _, err := ParseHeader(expr)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPropertySetter(t *testing.T) {
+	pub := amqp.Publishing{}
+	for _, p := range []property{
+		{"content_type", "application/json"}, {"content_encoding", "gzip"},
+		{"correlation_id", "c-1"}, {"reply_to", "replies"}, {"expiration", "60000"},
+		{"message_id", "m-1"}, {"type", "order"}, {"user_id", "guest"}, {"app_id", "replayer"},
+		{"delivery_mode", "2"}, {"priority", "9"}, {"timestamp", "2024-03-01T10:00:00Z"},
+	} {
+		set, err := propertySetter(p.name, p.value)
+		assert.NoError(t, err)
+		set(&pub)
+	}
+	assert.Equal(t, amqp.Publishing{
+		ContentType: "application/json", ContentEncoding: "gzip", CorrelationId: "c-1",
+		ReplyTo: "replies", Expiration: "60000", MessageId: "m-1", Type: "order",
+		UserId: "guest", AppId: "replayer", DeliveryMode: 2, Priority: 9,
+		Timestamp: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+	}, pub)
+
+	for _, p := range []property{{"body", "x"}, {"routing_key", "x"}, {"priority", "256"}, {"delivery_mode", "x"}, {"timestamp", "x"},
+		{"expiration", "-1"}, {"expiration", "1m"}, {"expiration", ""}, {"expiration", "1.5"}} {
+		_, err := propertySetter(p.name, p.value)
+		assert.Error(t, err, p.name+"="+p.value)
+		assert.Error(t, ValidateProperty(p.name, p.value))
+	}
+	assert.NoError(t, ValidateProperty("expiration", "0"))
+}
+
+func TestCommandRewrite(t *testing.T) {
+	deliveries := []amqp.Delivery{{
+		DeliveryTag: 1, Exchange: "shop", RoutingKey: "order.created", Priority: 1, AppId: "shop",
+		Headers: amqp.Table{"x-tenant": "acme", "x-trace": "t-1", "x-old": "v"},
+		Body:    []byte("1"),
+	}}
+
+	t.Run("Rewrite headers and properties", func(t *testing.T) {
+		tconn := testConnection{deliveries: deliveries}
+		amcmd := newTestCommand(&tconn, WithUntilEmpty(true), WithFile(os.DevNull),
+			WithRenameHeader("x-old", "x-new"),
+			WithRenameHeader("x-missing", "x-other"),
+			WithDeleteHeader("x-trace"),
+			WithSetHeader("x-replayed", true),
+			WithSetHeader("x-tenant", "other"),
+			WithProperty("expiration", "60000"),
+			WithProperty("priority", "5"),
+			WithProperty("delivery_mode", "2"),
+			WithProperty("app_id", "replayer"))
+		assert.NoError(t, amcmd.CommandCopyMoveToQueue("orders", "replay"))
+		assert.Len(t, tconn.published, 1)
+		pub := tconn.published[0]
+		assert.Equal(t, amqp.Table{"x-tenant": "other", "x-new": "v", "x-replayed": true}, pub.Headers)
+		assert.Equal(t, "60000", pub.Expiration)
+		assert.Equal(t, uint8(5), pub.Priority)
+		assert.Equal(t, uint8(2), pub.DeliveryMode)
+		assert.Equal(t, "replayer", pub.AppId)
+		assert.Equal(t, amqp.Table{"x-tenant": "acme", "x-trace": "t-1", "x-old": "v"}, tconn.deliveries[0].Headers)
+	})
+
+	t.Run("Provenance headers", func(t *testing.T) {
+		tconn := testConnection{deliveries: deliveries}
+		before := time.Now().UTC().Truncate(time.Second)
+		amcmd := newTestCommand(&tconn, WithUntilEmpty(true), WithFile(os.DevNull),
+			WithProvenance(true), WithSetHeader(HeaderSourceQueue, "overridden"))
+		assert.NoError(t, amcmd.CommandCopyMoveToQueue("orders", "replay"))
+		headers := tconn.published[0].Headers
+		assert.Equal(t, "orders", headers[HeaderSourceQueue])
+		assert.Equal(t, "shop", headers[HeaderSourceExchange])
+		assert.Equal(t, "order.created", headers[HeaderSourceRoutingKey])
+		assert.Equal(t, "acme", headers["x-tenant"])
+		movedAt, ok := headers[HeaderMovedAt].(time.Time)
+		assert.True(t, ok)
+		assert.False(t, movedAt.Before(before))
+	})
+
+	t.Run("Without rules", func(t *testing.T) {
+		tconn := testConnection{deliveries: deliveries}
+		amcmd := newTestCommand(&tconn, WithUntilEmpty(true), WithFile(os.DevNull))
+		assert.NoError(t, amcmd.CommandCopyMoveToQueue("orders", "replay"))
+		assert.Equal(t, tconn.deliveries[0].Headers, tconn.published[0].Headers)
+		assert.Equal(t, uint8(1), tconn.published[0].Priority)
+	})
+
+	t.Run("Error with invalid property", func(t *testing.T) {
+		tconn := testConnection{deliveries: deliveries}
+		amcmd := newTestCommand(&tconn, WithUntilEmpty(true), WithFile(os.DevNull), WithProperty("priority", "high"))
+		assert.Error(t, amcmd.CommandCopyMoveToQueue("orders", "replay"))
+		assert.Empty(t, tconn.published)
+	})
+}
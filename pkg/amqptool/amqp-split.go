@@ -0,0 +1,190 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// splitTimeFormat is the time of the timestamped output files
+const splitTimeFormat = "20060102T150405Z"
+
+// Manifest lists the files of a split output (see WithSplitEvery) with
+// their messages. It is written next to the files, with the name of
+// the output file and the .manifest.json extension.
+type Manifest struct {
+	Files    []ManifestFile `json:"files"`
+	Messages int            `json:"messages"`
+}
+
+// ManifestFile is a file of the manifest, with the name relative to
+// the manifest, the number of messages and the size (uncompressed)
+type ManifestFile struct {
+	File     string    `json:"file"`
+	Messages int       `json:"messages"`
+	Bytes    int64     `json:"bytes"`
+	Created  time.Time `json:"created"`
+}
+
+// splitWriter writes the messages in a sequence of files, rolling to
+// a new file before a message when the current one is full
+type splitWriter struct {
+	c           *CommandInfo
+	compression string
+	dir         string
+	base        string
+	ext         string
+	part        *outputPart
+	name        string
+	manifest    Manifest
+}
+
+// splitFormatExtensions and splitCompressionExtensions are the file
+// extensions kept at the end of the split file names
+var (
+	splitFormatExtensions      = []string{".jsonl", ".ndjson", ".json", ".csv", ".tsv", ".txt", ".log"}
+	splitCompressionExtensions = []string{".gz", ".zst", ".zstd"}
+)
+
+// splitName returns the directory, the name without the known
+// extensions and the extensions (e.g. ".jsonl.gz") of a file. Other
+// dots are part of the name (orders.v2.jsonl is orders.v2 and .jsonl).
+func splitName(file string) (string, string, string) {
+	dir, name := filepath.Split(file)
+	base := trimExtension(name, splitCompressionExtensions)
+	base = trimExtension(base, splitFormatExtensions)
+	return dir, base, name[len(base):]
+}
+
+// trimExtension removes from the name the first matching extension,
+// unless it is the whole name
+func trimExtension(name string, exts []string) string {
+	for _, ext := range exts {
+		if len(name) > len(ext) && strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// openSplitOutput starts the split output with the first file
+func (c *CommandInfo) openSplitOutput(compression string) (messageWriter, func() error, error) {
+	if c.file == "" {
+		return nil, nil, fmt.Errorf("Splitting the output needs an output file")
+	}
+	s := &splitWriter{c: c, compression: compression}
+	s.dir, s.base, s.ext = splitName(c.file)
+	err := s.roll()
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, s.close, nil
+}
+
+// manifestFile returns the path of the manifest
+func (s *splitWriter) manifestFile() string {
+	return filepath.Join(s.dir, s.base+".manifest.json")
+}
+
+// roll closes the current file (if any) and opens the next one
+func (s *splitWriter) roll() error {
+	if s.part != nil {
+		err := s.closePart()
+		if err != nil {
+			return err
+		}
+	}
+	n := len(s.manifest.Files) + 1
+	name := fmt.Sprintf("%s-%05d%s", s.base, n, s.ext)
+	if s.c.splitTimestamp {
+		name = fmt.Sprintf("%s-%s-%05d%s", s.base, time.Now().UTC().Format(splitTimeFormat), n, s.ext)
+	}
+	part, err := s.c.openPart(filepath.Join(s.dir, name), s.compression, s.manifest.Messages)
+	if err != nil {
+		return err
+	}
+	s.part, s.name = part, name
+	return nil
+}
+
+// closePart closes the current file and adds it to the manifest
+func (s *splitWriter) closePart() error {
+	err := s.part.close()
+	s.manifest.Files = append(s.manifest.Files, ManifestFile{
+		File:     s.name,
+		Messages: s.part.messages,
+		Bytes:    s.part.size.count,
+		Created:  s.part.created.UTC(),
+	})
+	s.manifest.Messages += s.part.messages
+	s.part = nil
+	if err != nil {
+		return err
+	}
+	return s.writeManifest()
+}
+
+// writeManifest writes the manifest with the closed files
+func (s *splitWriter) writeManifest() error {
+	data, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error encoding the manifest: %v", err)
+	}
+	err = ioutil.WriteFile(s.manifestFile(), append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("Error writing the manifest: %v", err)
+	}
+	return nil
+}
+
+// full reports if the current file reached a split limit
+func (s *splitWriter) full() bool {
+	p, c := s.part, s.c
+	return c.splitEvery > 0 && p.messages >= c.splitEvery ||
+		c.splitSize > 0 && p.size.count >= c.splitSize ||
+		c.splitInterval > 0 && time.Since(p.created) >= c.splitInterval
+}
+
+func (s *splitWriter) begin() error {
+	return nil
+}
+
+func (s *splitWriter) write(msg amqp.Delivery) error {
+	if s.part.messages > 0 && s.full() {
+		err := s.roll()
+		if err != nil {
+			return err
+		}
+	}
+	return s.part.write(msg)
+}
+
+func (s *splitWriter) end() error {
+	return nil
+}
+
+// close closes the last file and writes the final manifest
+func (s *splitWriter) close() error {
+	if s.part == nil {
+		return nil
+	}
+	return s.closePart()
+}
@@ -0,0 +1,159 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitName(t *testing.T) {
+	tests := []struct {
+		file string
+		dir  string
+		base string
+		ext  string
+	}{
+		{"orders", "", "orders", ""},
+		{"orders.jsonl", "", "orders", ".jsonl"},
+		{"out/orders.jsonl.gz", "out/", "orders", ".jsonl.gz"},
+		{"out/.hidden", "out/", ".hidden", ""},
+		{"orders.v2.jsonl.gz", "", "orders.v2", ".jsonl.gz"},
+		{"out.d/orders.2024.03.csv.zst", "out.d/", "orders.2024.03", ".csv.zst"},
+		{"orders.v2.gz", "", "orders.v2", ".gz"},
+		{"orders.v2", "", "orders.v2", ""},
+		{".jsonl", "", ".jsonl", ""},
+	}
+	for _, tt := range tests {
+		dir, base, ext := splitName(tt.file)
+		assert.Equal(t, []string{tt.dir, tt.base, tt.ext}, []string{dir, base, ext}, tt.file)
+	}
+}
+
+func TestCommandExportSplit(t *testing.T) {
+	t.Run("Split every 2 messages", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		amcmd := newTestCommand(&testConnection{}, WithCount(5), WithFile(filepath.Join(dir, "orders.txt")),
+			WithRawFormat("(", "-", ")"), WithSplitEvery(2))
+		assert.NoError(t, amcmd.CommandExport("test"))
+
+		for name, content := range map[string]string{
+			"orders-00001.txt": "(1-2)", "orders-00002.txt": "(3-4)", "orders-00003.txt": "(5)",
+		} {
+			data, err := ioutil.ReadFile(filepath.Join(dir, name))
+			assert.NoError(t, err)
+			assert.Equal(t, content, string(data))
+		}
+		assert.False(t, fileExists(filepath.Join(dir, "orders.txt")))
+
+		m := readManifest(t, filepath.Join(dir, "orders.manifest.json"))
+		assert.Equal(t, 5, m.Messages)
+		assert.Len(t, m.Files, 3)
+		assert.Equal(t, ManifestFile{File: "orders-00001.txt", Messages: 2, Bytes: 5, Created: m.Files[0].Created}, m.Files[0])
+		assert.Equal(t, 1, m.Files[2].Messages)
+		assert.False(t, m.Files[0].Created.IsZero())
+	})
+
+	t.Run("Split by size", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		amcmd := newTestCommand(&testConnection{}, WithCount(5), WithFile(filepath.Join(dir, "orders.txt")),
+			WithRawFormat("(", "-", ")"), WithSplitSize(4))
+		assert.NoError(t, amcmd.CommandExport("test"))
+		m := readManifest(t, filepath.Join(dir, "orders.manifest.json"))
+		assert.Equal(t, 5, m.Messages)
+		assert.Equal(t, []int{2, 2, 1}, []int{m.Files[0].Messages, m.Files[1].Messages, m.Files[2].Messages})
+	})
+
+	t.Run("Split by interval", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		amcmd := newTestCommand(&testConnection{}, WithCount(5), WithFile(filepath.Join(dir, "orders.txt")),
+			WithRawFormat("(", "-", ")"), WithSplitInterval(time.Nanosecond), WithSplitTimestamp(true))
+		assert.NoError(t, amcmd.CommandExport("test"))
+		m := readManifest(t, filepath.Join(dir, "orders.manifest.json"))
+		assert.Len(t, m.Files, 5)
+		assert.Regexp(t, regexp.MustCompile(`^orders-\d{8}T\d{6}Z-00005\.txt$`), m.Files[4].File)
+		data, err := ioutil.ReadFile(filepath.Join(dir, m.Files[4].File))
+		assert.NoError(t, err)
+		assert.Equal(t, "(5)", string(data))
+	})
+
+	t.Run("Split compressed files", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "orders.jsonl.gz")
+		amcmd := newTestCommand(&testConnection{}, WithCount(5), WithFile(file), WithFormat(FormatJSONL), WithSplitEvery(3))
+		assert.NoError(t, amcmd.CommandExport("test"))
+
+		tconn := testConnection{}
+		imp := newTestCommand(&tconn, WithFormat(FormatJSONL))
+		assert.NoError(t, imp.CommandImport(filepath.Join(dir, "orders-00002.jsonl.gz"), "test"))
+		assert.Equal(t, []string{"4", "5"}, tconn.dataResult)
+	})
+
+	t.Run("Split a template output", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		amcmd := newTestCommand(&testConnection{}, WithCount(5), WithFile(filepath.Join(dir, "orders.txt")),
+			WithTemplate("{{.Index}}"), WithRawFormat("(", "-", ")"), WithSplitEvery(2))
+		assert.NoError(t, amcmd.CommandExport("test"))
+
+		for name, content := range map[string]string{
+			"orders-00001.txt": "(0-1)", "orders-00002.txt": "(2-3)", "orders-00003.txt": "(4)",
+		} {
+			data, err := ioutil.ReadFile(filepath.Join(dir, name))
+			assert.NoError(t, err)
+			assert.Equal(t, content, string(data))
+		}
+	})
+
+	t.Run("Split a file name with dots", func(t *testing.T) {
+		dir := testTempDir()
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "orders.v2.jsonl.gz")
+		amcmd := newTestCommand(&testConnection{}, WithCount(3), WithFile(file), WithFormat(FormatJSONL), WithSplitEvery(2))
+		assert.NoError(t, amcmd.CommandExport("test"))
+
+		assert.Equal(t, []string{"orders.v2-00001.jsonl.gz", "orders.v2-00002.jsonl.gz", "orders.v2.manifest.json"}, dirFiles(t, dir))
+	})
+
+	t.Run("Error splitting stdout", func(t *testing.T) {
+		amcmd := newTestCommand(&testConnection{}, WithCount(5), WithSplitEvery(2))
+		assert.Error(t, amcmd.CommandExport("test"))
+	})
+
+	t.Run("Error creating the files", func(t *testing.T) {
+		amcmd := newTestCommand(&testConnection{}, WithCount(5),
+			WithFile(filepath.Join(os.TempDir(), "missing", "dir", "orders.txt")), WithSplitEvery(2))
+		assert.Error(t, amcmd.CommandExport("test"))
+	})
+}
+
+// readManifest reads the manifest of a split export
+func readManifest(t *testing.T, file string) Manifest {
+	var m Manifest
+	data, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &m))
+	return m
+}
@@ -0,0 +1,93 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/streadway/amqp"
+)
+
+// tableCellWidth is the maximum width of the headers and body cells
+// of the table format, longer values are truncated
+const tableCellWidth = 40
+
+// tableWriter writes the messages as a human readable table, aligned
+// when the output ends: the index, message id, routing key, content
+// type, body size, redelivered flag, headers and body of every message
+type tableWriter struct {
+	w     *tabwriter.Writer
+	index int
+}
+
+func newTableWriter(w io.Writer) *tableWriter {
+	return &tableWriter{w: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)}
+}
+
+func (t *tableWriter) begin() error {
+	_, err := fmt.Fprintln(t.w, "INDEX\tMESSAGE ID\tROUTING KEY\tCONTENT TYPE\tSIZE\tREDELIVERED\tHEADERS\tBODY")
+	return err
+}
+
+func (t *tableWriter) write(msg amqp.Delivery) error {
+	_, err := fmt.Fprintf(t.w, "%d\t%s\t%s\t%s\t%d\t%t\t%s\t%s\n", t.index,
+		tableCell(msg.MessageId), tableCell(msg.RoutingKey), tableCell(msg.ContentType),
+		len(msg.Body), msg.Redelivered, tableCell(headersSummary(msg.Headers)), tableCell(bodySummary(msg.Body)))
+	if err != nil {
+		return fmt.Errorf("Error writing message content in file: %v", err)
+	}
+	t.index++
+	return nil
+}
+
+func (t *tableWriter) end() error {
+	return t.w.Flush()
+}
+
+// headersSummary returns the headers as name=value, sorted by name
+func headersSummary(headers amqp.Table) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]string, 0, len(names))
+	for _, name := range names {
+		fields = append(fields, name+"="+formatValue(headerValue(headers[name])))
+	}
+	return strings.Join(fields, " ")
+}
+
+// bodySummary returns the body as text, or its size when it is binary
+func bodySummary(body []byte) string {
+	if !utf8.Valid(body) {
+		return fmt.Sprintf("<binary %d bytes>", len(body))
+	}
+	return string(body)
+}
+
+// tableCell returns the value in a single line (without tabs, that
+// would break the alignment) truncated to the cell width
+func tableCell(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if utf8.RuneCountInString(value) <= tableCellWidth {
+		return value
+	}
+	return string([]rune(value)[:tableCellWidth-3]) + "..."
+}
@@ -0,0 +1,49 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newTableWriter(&buf)
+	assert.NoError(t, w.begin())
+	assert.NoError(t, w.write(amqp.Delivery{MessageId: "o-1", RoutingKey: "order.created", ContentType: "application/json",
+		Headers: amqp.Table{"x-tenant": "acme", "x-retries": int32(2)}, Body: []byte("{\n\t\"id\": 1\n}")}))
+	assert.NoError(t, w.write(amqp.Delivery{RoutingKey: "order.raw", Redelivered: true, Body: []byte{0xff, 0x00}}))
+	assert.NoError(t, w.end())
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, strings.Index(lines[0], "ROUTING KEY"), strings.Index(lines[1], "order.created"), "aligned columns")
+	assert.Contains(t, lines[1], "x-retries=2 x-tenant=acme")
+	assert.Contains(t, lines[1], `{ "id": 1 }`)
+	assert.Contains(t, lines[2], "<binary 2 bytes>")
+	assert.Contains(t, lines[2], "true")
+}
+
+func TestTableCell(t *testing.T) {
+	assert.Equal(t, "", tableCell(""))
+	assert.Equal(t, "a b c", tableCell("a\tb\n c"))
+	long := strings.Repeat("á", 50)
+	assert.Equal(t, strings.Repeat("á", tableCellWidth-3)+"...", tableCell(long))
+	assert.Equal(t, strings.Repeat("á", tableCellWidth), tableCell(strings.Repeat("á", tableCellWidth)))
+}
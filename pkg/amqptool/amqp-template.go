@@ -0,0 +1,170 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// TemplateMessage is the data of every message rendered by the
+// template format (see WithTemplate)
+type TemplateMessage struct {
+	// Index is the position of the message in the output, from 0,
+	// and it goes on in the files of a split output
+	Index       int
+	Exchange    string
+	RoutingKey  string
+	Redelivered bool
+	Headers     amqp.Table
+
+	ContentType     string
+	ContentEncoding string
+	DeliveryMode    uint8
+	Priority        uint8
+	CorrelationId   string
+	ReplyTo         string
+	Expiration      string
+	MessageId       string
+	Timestamp       time.Time
+	Type            string
+	UserId          string
+	AppId           string
+
+	// Body is the raw body, Text the body as a string and JSON the
+	// parsed body (nil if it is not JSON, numbers as json.Number)
+	Body []byte
+	Text string
+	JSON interface{}
+}
+
+// newTemplateMessage builds the template data of a delivery
+func newTemplateMessage(index int, msg amqp.Delivery) TemplateMessage {
+	data := TemplateMessage{
+		Index:           index,
+		Exchange:        msg.Exchange,
+		RoutingKey:      msg.RoutingKey,
+		Redelivered:     msg.Redelivered,
+		Headers:         msg.Headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+		Text:            string(msg.Body),
+	}
+	dec := json.NewDecoder(bytes.NewReader(msg.Body))
+	dec.UseNumber()
+	var doc interface{}
+	if dec.Decode(&doc) == nil && !dec.More() {
+		data.JSON = doc
+	}
+	return data
+}
+
+// templateFuncs are the helpers available in the templates
+var templateFuncs = template.FuncMap{
+	"base64": func(v interface{}) string {
+		return base64.StdEncoding.EncodeToString([]byte(templateString(v)))
+	},
+	"json": func(v interface{}) (string, error) {
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"toUpper": func(v interface{}) string {
+		return strings.ToUpper(templateString(v))
+	},
+	"toLower": func(v interface{}) string {
+		return strings.ToLower(templateString(v))
+	},
+	"trim": func(v interface{}) string {
+		return strings.TrimSpace(templateString(v))
+	},
+	"replace": func(old, new string, v interface{}) string {
+		return strings.Replace(templateString(v), old, new, -1)
+	},
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+	"path": func(path string, doc interface{}) interface{} {
+		v, _ := jsonPath(doc, strings.Split(path, "."))
+		return v
+	},
+	"formatTime": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+	"unixTime": func(t time.Time) int64 {
+		return t.Unix()
+	},
+	"csv": func(v interface{}) string {
+		s := templateString(v)
+		if strings.ContainsAny(s, ",\"\r\n") {
+			return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+		}
+		return s
+	},
+	"sqlString": func(v interface{}) string {
+		return "'" + strings.Replace(templateString(v), "'", "''", -1) + "'"
+	},
+	"shellQuote": func(v interface{}) string {
+		return "'" + strings.Replace(templateString(v), "'", `'\''`, -1) + "'"
+	},
+}
+
+// templateString converts a template value to a string, with the
+// []byte values (bodies and byte array headers) as text
+func templateString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	}
+	return fmt.Sprint(v)
+}
+
+// parseTemplate parses the template of the template format
+func parseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, fmt.Errorf("The template format needs a template")
+	}
+	tmpl, err := template.New("message").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid template: %v", err)
+	}
+	return tmpl, nil
+}
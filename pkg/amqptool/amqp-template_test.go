@@ -0,0 +1,110 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateHelpers(t *testing.T) {
+	msg := amqp.Delivery{
+		RoutingKey: "order.created",
+		Timestamp:  time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC),
+		Headers:    amqp.Table{"x-tenant": "acme", "x-raw": []byte("it's")},
+		Body:       []byte(`{"id":"o-1","total":1234567,"note":"a, \"b\"","lines":[{"sku":"A1"}]}`),
+	}
+	tests := []struct {
+		name     string
+		template string
+		result   string
+	}{
+		{"Fields", "{{.Index}} {{.RoutingKey}} {{index .Headers \"x-tenant\"}}", "0 order.created acme"},
+		{"JSON body", "{{.JSON.id}} {{.JSON.total}}", "o-1 1234567"},
+		{"Path", "{{path \"lines.0.sku\" .JSON}}", "A1"},
+		{"Default", "{{default \"-\" (index .Headers \"x-missing\")}} {{default \"-\" (path \"lines.1.sku\" .JSON)}}", "- -"},
+		{"Base64", "{{base64 (index .Headers \"x-raw\")}}", "aXQncw=="},
+		{"JSON", "{{json .JSON.note}} {{json (index .Headers \"x-raw\")}}", `"a, \"b\"" "it's"`},
+		{"Case", "{{toUpper .RoutingKey}} {{toLower \"ABC\"}} [{{trim \" x \"}}]", "ORDER.CREATED abc [x]"},
+		{"Replace", "{{replace \".\" \"/\" .RoutingKey}}", "order/created"},
+		{"Time", "{{formatTime \"2006-01-02 15:04\" .Timestamp}} {{unixTime .Timestamp}}", "2024-03-01 10:30 1709289000"},
+		{"CSV", "{{csv .JSON.id}},{{csv .JSON.note}}", `o-1,"a, ""b"""`},
+		{"SQL", "{{sqlString (index .Headers \"x-raw\")}}", "'it''s'"},
+		{"Shell", "{{shellQuote (index .Headers \"x-raw\")}}", `'it'\''s'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseTemplate(tt.template)
+			assert.NoError(t, err)
+			var buf bytes.Buffer
+			assert.NoError(t, tmpl.Execute(&buf, newTemplateMessage(0, msg)))
+			assert.Equal(t, tt.result, buf.String())
+		})
+	}
+
+	t.Run("Body not JSON", func(t *testing.T) {
+		data := newTemplateMessage(3, amqp.Delivery{Body: []byte(`{"id":1} trailing`)})
+		assert.Nil(t, data.JSON)
+		assert.Equal(t, `{"id":1} trailing`, data.Text)
+		assert.Equal(t, 3, data.Index)
+	})
+
+	t.Run("Error without template", func(t *testing.T) {
+		_, err := parseTemplate("")
+		assert.Error(t, err)
+	})
+
+	t.Run("Error parsing template", func(t *testing.T) {
+		_, err := parseTemplate("{{.Text")
+		assert.Error(t, err)
+	})
+}
+
+func TestCommandExportTemplate(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpfileName := tmpfile.Name()
+	if err := tmpfile.Close(); err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(tmpfileName) // clean up
+
+	t.Run("Export with template", func(t *testing.T) {
+		amcmd := newTestCommand(&testConnection{}, WithCount(3), WithFile(tmpfileName),
+			WithRawFormat("index,body\n", "\n", "\n"), WithTemplate("{{.Index}},{{.Text}}"))
+		assert.NoError(t, amcmd.CommandExport("test"))
+		content, err := ioutil.ReadFile(tmpfileName)
+		assert.NoError(t, err)
+		assert.Equal(t, "index,body\n0,1\n1,2\n2,3\n", string(content))
+	})
+
+	t.Run("Error without template", func(t *testing.T) {
+		amcmd := newTestCommand(&testConnection{}, WithCount(3), WithFile(tmpfileName), WithFormat(FormatTemplate))
+		assert.Error(t, amcmd.CommandExport("test"))
+	})
+
+	t.Run("Error rendering template", func(t *testing.T) {
+		amcmd := newTestCommand(&testConnection{}, WithCount(3), WithFile(tmpfileName), WithTemplate("{{.Missing}}"))
+		assert.Error(t, amcmd.CommandExport("test"))
+	})
+}
@@ -0,0 +1,77 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSOptions defines the settings for amqps connections: custom CA
+// bundle, client certificate and server verification.
+type TLSOptions struct {
+	Enabled            bool
+	CACertFile         string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// enabled reports if the connection must be established over TLS,
+// explicitly or because any TLS specific setting is defined
+func (t TLSOptions) enabled() bool {
+	return t.Enabled ||
+		t.CACertFile != "" ||
+		t.CertFile != "" ||
+		t.KeyFile != "" ||
+		t.ServerName != "" ||
+		t.InsecureSkipVerify
+}
+
+// newTLSConfig builds the tls configuration for the amqps dialer,
+// loading the CA bundle and the client certificate from disk
+func newTLSConfig(t TLSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CACertFile != "" {
+		pem, err := ioutil.ReadFile(t.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No valid certificates found in CA file %s", t.CACertFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, fmt.Errorf("Both client certificate and key are required")
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
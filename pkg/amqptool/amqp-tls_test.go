@@ -0,0 +1,249 @@
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package amqptool
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// -- TEST CERTIFICATES --------------------------------------------------------
+// -----------------------------------------------------------------------------
+type testPKI struct {
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	caFile string
+	serial int64
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	p := &testPKI{dir: testTempDir(), serial: 1}
+
+	var err error
+	p.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(p.serial),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &p.caKey.PublicKey, p.caKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p.ca, err = x509.ParseCertificate(der)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p.caFile = p.writePEM("ca.pem", "CERTIFICATE", der)
+	return p
+}
+
+func (p *testPKI) writePEM(name, kind string, der []byte) string {
+	file := filepath.Join(p.dir, name)
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		log.Fatal(err)
+	}
+	return file
+}
+
+// issue creates a certificate signed by the test CA and returns the
+// certificate and key files
+func (p *testPKI) issue(name string, usage x509.ExtKeyUsage) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(p.serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, p.ca, &key.PublicKey, p.caKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	certFile := p.writePEM(name+".pem", "CERTIFICATE", der)
+	keyFile := p.writePEM(name+"-key.pem", "EC PRIVATE KEY", keyDer)
+	return certFile, keyFile
+}
+
+// serve starts a TLS server that requires a client certificate signed
+// by the test CA, and returns the address and the handshake result
+// channel
+func (p *testPKI) serve(t *testing.T, name string) (string, chan error) {
+	certFile, keyFile := p.issue(name, x509.ExtKeyUsageServerAuth)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(p.ca)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			result <- err
+			return
+		}
+		defer conn.Close()
+		result <- conn.(*tls.Conn).Handshake()
+	}()
+	return ln.Addr().String(), result
+}
+
+// -----------------------------------------------------------------------------
+// -- TEST START ---------------------------------------------------------------
+// -----------------------------------------------------------------------------
+func TestTLSOptionsEnabled(t *testing.T) {
+	assert.False(t, TLSOptions{}.enabled())
+	assert.True(t, TLSOptions{Enabled: true}.enabled())
+	assert.True(t, TLSOptions{CACertFile: "ca.pem"}.enabled())
+	assert.True(t, TLSOptions{ServerName: "rabbit"}.enabled())
+	assert.True(t, TLSOptions{InsecureSkipVerify: true}.enabled())
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	p := newTestPKI(t)
+	defer os.RemoveAll(p.dir)
+
+	t.Run("Handshake with CA and client certificate", func(t *testing.T) {
+		addr, result := p.serve(t, "rabbit.test")
+		certFile, keyFile := p.issue("client", x509.ExtKeyUsageClientAuth)
+
+		cfg, err := newTLSConfig(TLSOptions{
+			CACertFile: p.caFile,
+			CertFile:   certFile,
+			KeyFile:    keyFile,
+			ServerName: "rabbit.test",
+		})
+		assert.NoError(t, err)
+
+		conn, err := tls.Dial("tcp", addr, cfg)
+		assert.NoError(t, err)
+		if conn != nil {
+			conn.Close()
+		}
+		assert.NoError(t, <-result)
+	})
+
+	t.Run("Server name mismatch", func(t *testing.T) {
+		addr, _ := p.serve(t, "rabbit.test")
+		certFile, keyFile := p.issue("client", x509.ExtKeyUsageClientAuth)
+
+		cfg, err := newTLSConfig(TLSOptions{
+			CACertFile: p.caFile,
+			CertFile:   certFile,
+			KeyFile:    keyFile,
+			ServerName: "other.test",
+		})
+		assert.NoError(t, err)
+
+		_, err = tls.Dial("tcp", addr, cfg)
+		assert.Error(t, err)
+	})
+
+	t.Run("Insecure skip verify", func(t *testing.T) {
+		addr, result := p.serve(t, "rabbit.test")
+		certFile, keyFile := p.issue("client", x509.ExtKeyUsageClientAuth)
+
+		cfg, err := newTLSConfig(TLSOptions{
+			CertFile:           certFile,
+			KeyFile:            keyFile,
+			InsecureSkipVerify: true,
+		})
+		assert.NoError(t, err)
+
+		conn, err := tls.Dial("tcp", addr, cfg)
+		assert.NoError(t, err)
+		if conn != nil {
+			conn.Close()
+		}
+		assert.NoError(t, <-result)
+	})
+
+	t.Run("Error reading CA file", func(t *testing.T) {
+		_, err := newTLSConfig(TLSOptions{CACertFile: filepath.Join(p.dir, "missing.pem")})
+		assert.Error(t, err)
+	})
+
+	t.Run("Error with invalid CA file", func(t *testing.T) {
+		file := filepath.Join(p.dir, "invalid.pem")
+		if err := ioutil.WriteFile(file, []byte("invalid"), 0600); err != nil {
+			log.Fatal(err)
+		}
+		_, err := newTLSConfig(TLSOptions{CACertFile: file})
+		assert.Error(t, err)
+	})
+
+	t.Run("Error with certificate and no key", func(t *testing.T) {
+		certFile, _ := p.issue("client", x509.ExtKeyUsageClientAuth)
+		_, err := newTLSConfig(TLSOptions{CertFile: certFile})
+		assert.Error(t, err)
+	})
+
+	t.Run("Error with mismatched key", func(t *testing.T) {
+		certFile, _ := p.issue("client", x509.ExtKeyUsageClientAuth)
+		_, otherKey := p.issue("other", x509.ExtKeyUsageClientAuth)
+		_, err := newTLSConfig(TLSOptions{CertFile: certFile, KeyFile: otherKey})
+		assert.Error(t, err)
+	})
+
+	t.Run("Error dialing with invalid TLS settings", func(t *testing.T) {
+		amcmd := NewCommandInfo(WithConnection(ConnectionSettings{Host: "host", Port: 1000,
+			TLS: TLSOptions{CACertFile: filepath.Join(p.dir, "missing.pem")}}))
+		assert.Error(t, amcmd.CommandExport("test"))
+	})
+}